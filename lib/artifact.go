@@ -0,0 +1,70 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+/*
+Artifacts archived by the build are listed with the paths relative to the archive.
+
+% curl -s "http://localhost:8080/job/build/lastSuccessfulBuild/api/json?tree=number,artifacts[fileName,relativePath]" | jq .
+{
+  "number": 57,
+  "artifacts": [
+    {
+      "fileName": "app.tar.gz",
+      "relativePath": "dist/app.tar.gz"
+    }
+  ]
+}
+*/
+
+type artifactBuild struct {
+	Number    int `json:"number"`
+	Artifacts []struct {
+		FileName     string `json:"fileName"`
+		RelativePath string `json:"relativePath"`
+	} `json:"artifacts"`
+}
+
+// hasArtifact reports whether an artifact matches the glob by its relative path or its file name
+func (b artifactBuild) hasArtifact(glob string) bool {
+	for _, a := range b.Artifacts {
+		if ok, _ := path.Match(glob, a.RelativePath); ok {
+			return true
+		}
+		if ok, _ := path.Match(glob, a.FileName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArtifacts alerts when no artifact of the last successful build matches some glob of `--expect-artifact`,
+// catching pipelines which succeed but stop publishing what they deliver
+func (c *Client) checkArtifacts(ctx context.Context, t target) *checkers.Checker {
+	var b artifactBuild
+	if err := c.fetchJobJSON(ctx, t, "/lastSuccessfulBuild/api/json?tree=number,artifacts[fileName,relativePath]", &b); err != nil {
+		if e, ok := err.(*httpStatusError); ok && e.code == 404 {
+			// No successful build has anything to verify yet
+			return nil
+		}
+		return c.fetchErrorChecker(err)
+	}
+	missing := make([]string, 0)
+	for _, g := range c.opts.ExpectArtifacts {
+		if !b.hasArtifact(g) {
+			missing = append(missing, g)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("Last successful build id = %d has no artifact matching %s %s", b.Number, strings.Join(missing, ", "), c.jobURL(t.job, fmt.Sprintf("/%d/", b.Number)))
+	return checkers.NewChecker(parseStatus(c.opts.MissingArtifactStatus), msg)
+}
@@ -0,0 +1,189 @@
+package checkjenkinsbuildtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+The secret of `--aws-secret-id` is read by GetSecretValue of AWS Secrets Manager, signed by Signature Version 4.
+Credentials are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN,
+or from the role of the EC2 instance by IMDSv2. The region is that of the ARN, or AWS_REGION.
+*/
+
+const imdsURL = "http://169.254.169.254/latest"
+
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+func awsCredentialsFromEnv() (awsCredentials, bool) {
+	cred := awsCredentials{os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}
+	return cred, cred.AccessKeyID != "" && cred.SecretAccessKey != ""
+}
+
+func imdsGet(ctx context.Context, hc *http.Client, path, token string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imdsURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("instance metadata answered %s for %s", resp.Status, path)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// awsCredentialsFromInstance returns the credentials of the role of the EC2 instance
+func awsCredentialsFromInstance(ctx context.Context, hc *http.Client) (awsCredentials, error) {
+	var cred awsCredentials
+	req, err := http.NewRequestWithContext(ctx, "PUT", imdsURL+"/api/token", nil)
+	if err != nil {
+		return cred, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return cred, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return cred, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return cred, fmt.Errorf("instance metadata answered %s for the token", resp.Status)
+	}
+	token := string(b)
+	role, err := imdsGet(ctx, hc, "/meta-data/iam/security-credentials/", token)
+	if err != nil {
+		return cred, err
+	}
+	b, err = imdsGet(ctx, hc, "/meta-data/iam/security-credentials/"+strings.TrimSpace(string(role)), token)
+	if err != nil {
+		return cred, err
+	}
+	err = json.Unmarshal(b, &cred)
+	return cred, err
+}
+
+// awsRegion returns the region of the ARN, falling back to the environment for secret names
+func awsRegion(secretID string) string {
+	if parts := strings.Split(secretID, ":"); len(parts) > 3 && parts[0] == "arn" {
+		return parts[3]
+	}
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		return r
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// signV4 signs the request to the AWS service with Signature Version 4
+func signV4(req *http.Request, body []byte, cred awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if cred.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", cred.Token)
+	}
+	names := []string{"content-type", "host", "x-amz-date"}
+	if cred.Token != "" {
+		names = append(names, "x-amz-security-token")
+	}
+	names = append(names, "x-amz-target")
+	var headers strings.Builder
+	for _, n := range names {
+		v := req.Header.Get(n)
+		if n == "host" {
+			v = req.URL.Host
+		}
+		fmt.Fprintf(&headers, "%s:%s\n", n, strings.TrimSpace(v))
+	}
+	signed := strings.Join(names, ";")
+	canonical := strings.Join([]string{req.Method, "/", "", headers.String(), signed, sha256Hex(body)}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+	key := hmacSHA256([]byte("AWS4"+cred.SecretAccessKey), date)
+	for _, s := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cred.AccessKeyID, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func (c *Client) fetchAWSSecret(ctx context.Context, secretID string) (string, error) {
+	region := awsRegion(secretID)
+	if region == "" {
+		return "", errors.New("AWS_REGION is required for the secret name without the ARN")
+	}
+	cred, ok := awsCredentialsFromEnv()
+	if !ok {
+		var err error
+		if cred, err = awsCredentialsFromInstance(ctx, c.metadataClient()); err != nil {
+			return "", fmt.Errorf("no AWS credentials in the environment nor the instance metadata: %s", err)
+		}
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", region)
+	if e := os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER"); e != "" {
+		endpoint = strings.TrimRight(e, "/") + "/"
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signV4(req, body, cred, region, "secretsmanager", time.Now())
+	resp, err := c.outboundClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("secrets manager answered %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	var v struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return "", err
+	}
+	if v.SecretString == "" {
+		return "", errors.New("the secret has no SecretString")
+	}
+	return v.SecretString, nil
+}
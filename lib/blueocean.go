@@ -0,0 +1,116 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Blue Ocean REST API returns runs with their state separated from the result.
+
+% curl -s "http://localhost:8080/blue/rest/organizations/jenkins/pipelines/pipeline/runs/?limit=2" | jq .
+[
+  {
+    "id": "57",
+    "state": "RUNNING",
+    "result": "UNKNOWN",
+    "startTime": "2017-08-19T21:40:42.652+0900",
+    "durationInMillis": 0,
+    "estimatedDurationInMillis": 30120
+  },
+  {
+    "id": "56",
+    "state": "FINISHED",
+    "result": "SUCCESS",
+    "startTime": "2017-08-19T21:02:12.413+0900",
+    "durationInMillis": 29811,
+    "estimatedDurationInMillis": 30120
+  }
+]
+*/
+
+const blueTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+type blueRun struct {
+	ID                        string `json:"id"`
+	State                     string `json:"state"`
+	Result                    string `json:"result"`
+	StartTime                 string `json:"startTime"`
+	DurationInMillis          int64  `json:"durationInMillis"`
+	EstimatedDurationInMillis int64  `json:"estimatedDurationInMillis"`
+}
+
+// toBuild converts the run to the build of the classic API, which has no result until finished
+func (r blueRun) toBuild() (build, error) {
+	n, err := strconv.Atoi(r.ID)
+	if err != nil {
+		return build{}, fmt.Errorf("invalid run id %q: %s", r.ID, err)
+	}
+	start, err := time.Parse(blueTimeLayout, r.StartTime)
+	if err != nil {
+		return build{}, fmt.Errorf("invalid start time of run %s: %s", r.ID, err)
+	}
+	b := build{
+		Number:            n,
+		Timestamp:         jsonTime(start),
+		Duration:          r.DurationInMillis,
+		EstimatedDuration: r.EstimatedDurationInMillis,
+	}
+	if r.State == "FINISHED" {
+		result := r.Result
+		b.Result = &result
+	}
+	return b, nil
+}
+
+// bluePipelinePath maps the job to Blue Ocean, where folders are nested pipelines
+// and branches of a multibranch pipeline are found under `branches`.
+func bluePipelinePath(t target) string {
+	segs := strings.Split(strings.Trim(t.job, "/"), "/")
+	var b strings.Builder
+	for i, seg := range segs {
+		if t.branch && i == len(segs)-1 {
+			b.WriteString("/branches/")
+		} else {
+			b.WriteString("/pipelines/")
+		}
+		b.WriteString(url.PathEscape(seg))
+	}
+	return b.String()
+}
+
+// blueRunsURL returns the newest runs of the job up to the number of builds checked
+func (c *Client) blueRunsURL(t target) string {
+	return fmt.Sprintf("%s/blue/rest/organizations/%s%s/runs/?limit=%d", c.baseURL(), url.PathEscape(c.opts.BlueOceanOrg), bluePipelinePath(t), t.maxJobNumber)
+}
+
+// fetchBlueBuilds returns builds of the job from newest to oldest via Blue Ocean.
+// The last successful build is taken from the fetched runs since Blue Ocean does not report it for the pipeline.
+func (c *Client) fetchBlueBuilds(ctx context.Context, t target) (builds, error) {
+	var bs builds
+	var runs []blueRun
+	if err := c.fetchJSON(ctx, c.blueRunsURL(t), t.cred, &runs); err != nil {
+		return bs, err
+	}
+	bs.Builds = make([]build, 0, len(runs))
+	for _, r := range runs {
+		// Queued runs have not started yet
+		if r.State == "QUEUED" {
+			continue
+		}
+		b, err := r.toBuild()
+		if err != nil {
+			return bs, err
+		}
+		bs.Builds = append(bs.Builds, b)
+		if bs.LastSuccessfulBuild == nil && b.hasResult("SUCCESS") {
+			last := b
+			bs.LastSuccessfulBuild = &last
+		}
+	}
+	return bs, nil
+}
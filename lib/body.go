@@ -0,0 +1,77 @@
+package checkjenkinsbuildtime
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// responseTooLargeError is returned when the body of the response exceeds `--max-response-bytes`,
+// typically a misdirected URL answering a huge page
+type responseTooLargeError struct {
+	max int64
+}
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("the response exceeds %d bytes of --max-response-bytes", e.max)
+}
+
+// limitedBody fails reading beyond max bytes instead of silently truncating, which would look like broken JSON
+type limitedBody struct {
+	io.Reader
+	// closers are closed in order, the decompressor before the original body
+	closers   []io.Closer
+	remaining int64
+	max       int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.Reader.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = 0
+		return n, &responseTooLargeError{b.max}
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	var err error
+	for _, c := range b.closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// wrapBody decompresses the gzip response and bounds what is read by `--max-response-bytes` after decompression.
+// Since the request asks for gzip explicitly, net/http leaves decoding it to us.
+func (c *Client) wrapBody(resp *http.Response) error {
+	body := &limitedBody{Reader: resp.Body, closers: []io.Closer{resp.Body}, remaining: c.opts.MaxResponseBytes, max: c.opts.MaxResponseBytes}
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to decompress the response: %s", err)
+		}
+		if err == nil {
+			body.Reader = zr
+			body.closers = []io.Closer{zr, resp.Body}
+		}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	if c.opts.MaxResponseBytes <= 0 {
+		body.remaining = 1<<63 - 2
+	}
+	resp.Body = body
+	return nil
+}
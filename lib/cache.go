@@ -0,0 +1,108 @@
+package checkjenkinsbuildtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+/*
+The cache file given by `--cache-file` keeps the builds of each job fetched last,
+which are checked instead when Jenkins cannot answer for a while, e.g. while restarting.
+
+{
+  "jobs": {
+    "deploy": {
+      "fetched_at": "2024-01-02T15:04:05Z",
+      "builds": {"builds": [...], "lastSuccessfulBuild": {...}}
+    }
+  }
+}
+*/
+
+type cache struct {
+	Jobs map[string]cachedJob `json:"jobs"`
+}
+
+type cachedJob struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Builds    builds    `json:"builds"`
+}
+
+func loadCache(path string) (*cache, error) {
+	ca := &cache{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		ca.Jobs = make(map[string]cachedJob)
+		return ca, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, ca); err != nil {
+		return nil, fmt.Errorf("invalid cache file %s: %s", path, err)
+	}
+	if ca.Jobs == nil {
+		ca.Jobs = make(map[string]cachedJob)
+	}
+	// Timestamps are cached in milliseconds whatever `--timestamp-unit` is, as Jenkins reports them
+	for _, j := range ca.Jobs {
+		for i := range j.Builds.Builds {
+			j.Builds.Builds[i].Timestamp = j.Builds.Builds[i].Timestamp.inUnit("ms")
+		}
+		if b := j.Builds.LastSuccessfulBuild; b != nil {
+			b.Timestamp = b.Timestamp.inUnit("ms")
+		}
+	}
+	return ca, nil
+}
+
+// cacheBuilds records the builds fetched successfully
+func (c *Client) cacheBuilds(t target, bs builds) error {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	ca, err := loadCache(c.opts.CacheFile)
+	if err != nil {
+		return err
+	}
+	ca.Jobs[t.label()] = cachedJob{c.now(), bs}
+	b, err := json.MarshalIndent(ca, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.opts.CacheFile, b)
+}
+
+// cachedBuilds returns the builds cached within `--cache-max-age` and when they were fetched
+func (c *Client) cachedBuilds(t target) (builds, time.Time, bool) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	ca, err := loadCache(c.opts.CacheFile)
+	if err != nil {
+		return builds{}, time.Time{}, false
+	}
+	j, ok := ca.Jobs[t.label()]
+	if !ok || c.now().Sub(j.FetchedAt) > c.opts.CacheMaxAge.Duration() {
+		return builds{}, time.Time{}, false
+	}
+	// The time in the queue is not cached but computed again from the actions
+	if c.opts.ExcludeQueueTime {
+		for i := range j.Builds.Builds {
+			j.Builds.Builds[i].queued = j.Builds.Builds[i].queueTime()
+		}
+	}
+	return j.Builds, j.FetchedAt, true
+}
+
+// isTransientError reports whether the fetch may succeed soon, in which case the cache is checked instead
+func isTransientError(err error) bool {
+	switch e := err.(type) {
+	case *inputError, *credentialExpiredError:
+		return false
+	case *httpStatusError:
+		return e.code >= 500
+	}
+	return true
+}
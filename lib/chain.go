@@ -0,0 +1,131 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+/*
+Freestyle jobs chained by triggers list their downstream jobs, and a downstream build tells the upstream build in its causes.
+
+% curl -s "http://localhost:8080/job/build/api/json?tree=downstreamProjects[fullName]" | jq .
+{
+  "downstreamProjects": [
+    {
+      "fullName": "deploy"
+    }
+  ]
+}
+
+% curl -s "http://localhost:8080/job/deploy/api/json?tree=builds[number,timestamp,duration,actions[causes[upstreamProject,upstreamBuild]]]{,10}" | jq .builds[0]
+{
+  "number": 31,
+  "timestamp": 1503146442652,
+  "duration": 30120,
+  "actions": [
+    {
+      "causes": [
+        {
+          "upstreamProject": "build",
+          "upstreamBuild": 57
+        }
+      ]
+    }
+  ]
+}
+*/
+
+// maxChainDepth bounds how far downstream jobs are followed, in case triggers form a cycle
+const maxChainDepth = 10
+
+type downstreamProjects struct {
+	DownstreamProjects []struct {
+		FullName string `json:"fullName"`
+	} `json:"downstreamProjects"`
+}
+
+type chainBuild struct {
+	build
+	Actions []struct {
+		Causes []struct {
+			UpstreamProject string `json:"upstreamProject"`
+			UpstreamBuild   int    `json:"upstreamBuild"`
+		} `json:"causes"`
+	} `json:"actions"`
+}
+
+func (b chainBuild) isTriggeredBy(job string, number int) bool {
+	for _, a := range b.Actions {
+		for _, cause := range a.Causes {
+			if cause.UpstreamProject == job && cause.UpstreamBuild == number {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// chainEnd returns when the last build triggered downstream of the build finished, or now if any of them is running
+func (c *Client) chainEnd(ctx context.Context, t target, b build, depth int) (time.Time, error) {
+	end := b.startedAt().Add(b.executionTime())
+	if b.isUnfinished() {
+		end = c.now()
+	}
+	if depth >= maxChainDepth {
+		return end, nil
+	}
+	var ds downstreamProjects
+	if err := c.fetchJobJSON(ctx, t, "/api/json?tree=downstreamProjects[fullName]", &ds); err != nil {
+		return end, err
+	}
+	for _, p := range ds.DownstreamProjects {
+		dt := t
+		dt.job = p.FullName
+		var bs struct {
+			Builds []chainBuild `json:"builds"`
+		}
+		path := fmt.Sprintf("/api/json?tree=builds[%s,actions[causes[upstreamProject,upstreamBuild]]]{,%d}", buildFields, t.maxJobNumber)
+		if err := c.fetchJobJSON(ctx, dt, path, &bs); err != nil {
+			return end, err
+		}
+		for _, db := range bs.Builds {
+			if !db.isTriggeredBy(strings.Trim(t.job, "/"), b.Number) {
+				continue
+			}
+			e, err := c.chainEnd(ctx, dt, c.normalizeBuild(db.build), depth+1)
+			if err != nil {
+				return end, err
+			}
+			if e.After(end) {
+				end = e
+			}
+		}
+	}
+	return end, nil
+}
+
+// checkChain alerts on the newest build and the builds triggered downstream of it taking too long in total
+// by `--chain-warning` and `--chain-critical`, even if each of the builds is within the thresholds
+func (c *Client) checkChain(ctx context.Context, t target, bs []build) *checkers.Checker {
+	if len(bs) == 0 {
+		return nil
+	}
+	b := bs[0]
+	end, err := c.chainEnd(ctx, t, b, 0)
+	if err != nil {
+		return c.fetchErrorChecker(err)
+	}
+	elapsed := end.Sub(b.startedAt())
+	msg := fmt.Sprintf("Chain from build id = %d takes %s in total %s", b.Number, elapsed.Round(time.Second), c.buildURL(t, b))
+	switch {
+	case c.opts.ChainCritical > 0 && elapsed > c.opts.ChainCritical.Duration():
+		return checkers.Critical(msg)
+	case c.opts.ChainWarning > 0 && elapsed > c.opts.ChainWarning.Duration():
+		return checkers.Warning(msg)
+	}
+	return nil
+}
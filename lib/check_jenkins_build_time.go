@@ -1,26 +1,208 @@
 package checkjenkinsbuildtime
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
+	"reflect"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/mackerelio/checkers"
 )
 
-var opts struct {
-	Scheme        string `short:"s" long:"scheme" default:"http" description:"Jenkins scheme"`
-	Host          string `short:"h" long:"host" default:"localhost" description:"Jenkins hostname"`
-	Port          int64  `short:"p" long:"port" default:"8080" description:"Jenkins port"`
-	JobName       string `short:"j" long:"job-name" required:"true" description:"Monitor job name"`
-	MaxJobNumber  int64  `long:"max-job-number" default:"10" description:"Number of recent jobs to monitor"`
-	WarningSecond int64  `short:"w" long:"warning-second" default:"60" description:"Trigger a warning if over the seconds"`
-	CritSecond    int64  `short:"c" long:"critical-second" default:"300" description:"Trigger a critical if over the seconds"`
+// Options configures the check, declared with flags of go-flags.
+// Use NewOptions to start from the defaults of the flags.
+type Options struct {
+	Scheme                       string        `short:"s" long:"scheme" default:"http" description:"Jenkins scheme"`
+	Host                         string        `short:"h" long:"host" default:"localhost" description:"Jenkins hostname"`
+	Port                         int64         `short:"p" long:"port" default:"8080" description:"Jenkins port"`
+	URL                          string        `long:"url" description:"Jenkins base URL (e.g. https://jenkins.example.com), overrides --scheme, --host and --port"`
+	Prefix                       string        `long:"prefix" description:"Jenkins context path (e.g. /jenkins)"`
+	JobNames                     []string      `short:"j" long:"job-name" description:"Monitor job name, separated by slashes for jobs in folders (repeatable, default: $JENKINS_JOB_NAME)"`
+	JobsFile                     string        `long:"jobs-file" description:"File listing jobs to monitor one per line, read on every check"`
+	MaxJobNumber                 int64         `long:"max-job-number" default:"10" description:"Number of recent jobs to monitor"`
+	WarningSecond                duration      `short:"w" long:"warning-second" default:"60" description:"Trigger a warning if over the seconds or the duration (e.g. 90m)"`
+	CritSecond                   duration      `short:"c" long:"critical-second" default:"300" description:"Trigger a critical if over the seconds or the duration (e.g. 4h)"`
+	Warning                      time.Duration `long:"warning" description:"Trigger a warning if over the duration (e.g. 90m), instead of --warning-second"`
+	Critical                     time.Duration `long:"critical" description:"Trigger a critical if over the duration (e.g. 4h), instead of --critical-second"`
+	NoWarning                    bool          `long:"no-warning" description:"Disable the warning threshold, alerting on build time only at critical"`
+	NoCritical                   bool          `long:"no-critical" description:"Disable the critical threshold, alerting on build time only at warning"`
+	Headers                      []string      `long:"header" description:"Header of 'Name: value' sent with every request to Jenkins (repeatable)"`
+	UserAgent                    string        `long:"user-agent" description:"User-Agent sent to Jenkins (default: check-jenkins-build-time/<version>)"`
+	HostHeader                   string        `long:"host-header" description:"Host header to send instead of the Jenkins hostname"`
+	OkCode                       int           `long:"ok-code" default:"0" description:"Exit code for OK"`
+	WarningCode                  int           `long:"warning-code" default:"1" description:"Exit code for WARNING"`
+	CriticalCode                 int           `long:"critical-code" default:"2" description:"Exit code for CRITICAL"`
+	UnknownCode                  int           `long:"unknown-code" default:"3" description:"Exit code for UNKNOWN"`
+	Concurrency                  int64         `long:"concurrency" default:"1" description:"Number of jobs checked in parallel"`
+	ScanAll                      bool          `long:"scan-all" description:"Scan the whole build history instead of recent builds"`
+	AllBuilds                    bool          `long:"all-builds" description:"Fetch --max-job-number builds by pages of allBuilds, for values over the 100 builds limit of Jenkins"`
+	ScanPageSize                 int64         `long:"scan-page-size" default:"100" description:"Number of builds fetched per page with --scan-all and --all-builds"`
+	ScanConcurrency              int64         `long:"scan-concurrency" default:"4" description:"Number of pages fetched in parallel with --scan-all and --all-builds"`
+	AggregateSecond              duration      `long:"aggregate-seconds" description:"Trigger a warning if the total elapsed time of running builds is over the seconds or the duration"`
+	ExpectRunning                string        `long:"expect-running" optional:"yes" optional-value:"critical" choice:"warning" choice:"critical" description:"Trigger an alert if no build is running"`
+	RunningWarning               int           `long:"running-warning" description:"Trigger a warning if the number of running builds is the count or more"`
+	RunningCritical              int           `long:"running-critical" description:"Trigger a critical if the number of running builds is the count or more"`
+	OnlyCause                    []string      `long:"only-cause" choice:"timer" choice:"scm" choice:"user" choice:"upstream" choice:"replay" description:"Check only builds triggered by the cause (repeatable)"`
+	IgnoreCause                  []string      `long:"ignore-cause" choice:"timer" choice:"scm" choice:"user" choice:"upstream" choice:"replay" description:"Ignore builds triggered by the cause, e.g. replay for replayed or rebuilt builds (repeatable)"`
+	Params                       []string      `long:"param" description:"Check only builds with the parameter of KEY=VALUE (repeatable)"`
+	ExcludeParams                []string      `long:"exclude-param" description:"Ignore builds with the parameter of KEY=VALUE (repeatable)"`
+	ExcludeQueueTime             bool          `long:"exclude-queue-time" description:"Exclude the time waiting in the queue from elapsed times (requires the Metrics plugin)"`
+	MuteWindows                  []string      `long:"mute-window" description:"Report warnings and criticals as OK in the weekly window (e.g. 'Sat 02:00-06:00', 'Mon-Fri 22:00-06:00', repeatable)"`
+	Timezone                     string        `long:"timezone" description:"Timezone of --mute-window and schedules in --config (e.g. Asia/Tokyo, default: local)"`
+	NotifyWebhook                string        `long:"notify-webhook" description:"URL to POST the result as JSON when the status changed (requires --state-file unless --watch or --serve)"`
+	CacheFile                    string        `long:"cache-file" description:"File to keep the builds fetched last, checked instead when Jenkins fails to answer, e.g. while restarting"`
+	CacheMaxAge                  duration      `long:"cache-max-age" default:"10m" description:"Age over which the builds in --cache-file are too old to check"`
+	StateFile                    string        `long:"state-file" description:"File to record alerts of each job across runs"`
+	AlertOnce                    bool          `long:"alert-once" description:"Report an alert already recorded in --state-file as OK until it changes or resolves"`
+	ShowDisplayName              bool          `long:"show-display-name" description:"Include display names of builds in messages"`
+	ShowParams                   bool          `long:"show-params" description:"Include parameters of builds in messages"`
+	CheckName                    string        `long:"check-name" description:"Name of the checker in the output (default: JenkinsBuildTime-<job> for a single job, JenkinsBuildTime otherwise)"`
+	MessageTemplate              string        `long:"message-template" description:"Go text/template of the message of each build over the thresholds, with .Job, .Number, .DisplayName, .Status, .Running, .Elapsed, .Threshold, .URL and .Message"`
+	OldestOnly                   bool          `long:"oldest-only" description:"Compare only the oldest running build with the thresholds"`
+	MaxMessageLen                int           `long:"max-message-length" description:"Truncate the message to the characters"`
+	Output                       string        `long:"output" default:"text" choice:"text" choice:"json" description:"Print the result as the text line or JSON with the evaluation of each build"`
+	Format                       string        `long:"format" default:"mackerel" choice:"mackerel" choice:"nagios" choice:"prometheus" choice:"sensu" description:"Style of the output (nagios: with perfdata, prometheus: metrics in the textfile collector format, sensu: for Sensu Go checks)"`
+	SensuAgentAPI                string        `long:"sensu-agent-api" description:"Also send the result with --sensu-annotation to the Sensu Go agent API (e.g. http://127.0.0.1:3031)"`
+	SensuAnnotations             []string      `long:"sensu-annotation" description:"Annotation of KEY=VALUE for Sensu Go handlers sent with --sensu-agent-api (repeatable)"`
+	OutputFile                   string        `long:"output-file" description:"Write the metrics of --format=prometheus to the file, printing the Mackerel line instead"`
+	Metric                       bool          `long:"metric" description:"Print build durations as metrics of mackerel-plugin instead of the check result"`
+	Syslog                       bool          `long:"syslog" description:"Also write the result to the local syslog"`
+	Exec                         string        `long:"exec" description:"Command line run in the shell with the status and the message as arguments when the result is not OK"`
+	TimestampUnit                string        `long:"timestamp-unit" default:"ms" choice:"ms" choice:"ns" choice:"s" description:"Unit of build timestamps in the response"`
+	Serve                        string        `long:"serve" description:"Serve /healthz and /metrics for Prometheus on the address (e.g. :9118) instead of checking once"`
+	Watch                        bool          `long:"watch" description:"Check repeatedly on --interval printing a line with the time each, instead of checking once"`
+	Interval                     duration      `long:"interval" default:"30s" description:"Interval of checks with --watch"`
+	PollInterval                 duration      `long:"poll-interval" description:"Poll Jenkins on the interval with --serve and answer from the latest result, instead of checking on each request"`
+	BuildNumber                  int           `long:"build-number" description:"Check only the build of the number instead of recent builds"`
+	LastBuildOnly                bool          `long:"last-build-only" description:"Check only the newest build via lastBuild instead of recent builds"`
+	API                          string        `long:"api" default:"classic" choice:"classic" choice:"blueocean" description:"API to fetch builds with"`
+	BlueOceanOrg                 string        `long:"blueocean-organization" default:"jenkins" description:"Blue Ocean organization of the jobs with --api=blueocean"`
+	StrictSchema                 bool          `long:"strict-schema" description:"Return unknown if the response lacks the builds key"`
+	User                         string        `short:"u" long:"user" env:"JENKINS_USER" description:"Jenkins user name for basic auth"`
+	APIToken                     string        `long:"api-token" env:"JENKINS_API_TOKEN" description:"Jenkins API token (or password) for basic auth"`
+	Insecure                     bool          `short:"k" long:"insecure" description:"Skip verification of the Jenkins TLS certificate"`
+	CAFile                       string        `long:"ca-file" description:"PEM bundle of CA certificates to verify Jenkins with"`
+	CertFile                     string        `long:"cert-file" description:"Client certificate file for mutual TLS"`
+	KeyFile                      string        `long:"key-file" description:"Client private key file for mutual TLS"`
+	Proxy                        string        `long:"proxy" description:"Proxy URL used instead of HTTP_PROXY/HTTPS_PROXY"`
+	NoProxy                      bool          `long:"no-proxy" description:"Connect to Jenkins directly ignoring proxy environment variables"`
+	Socks5                       string        `long:"socks5" description:"SOCKS5 proxy address (host:port) to dial Jenkins through"`
+	Socks5User                   string        `long:"socks5-user" description:"User name for the SOCKS5 proxy"`
+	Socks5Password               string        `long:"socks5-password" description:"Password for the SOCKS5 proxy"`
+	CredentialCommand            string        `long:"credential-command" description:"Command printing the user and the API token as user:token, or username= and password= lines, run on every check"`
+	VaultPath                    string        `long:"vault-path" description:"Path of the secret in HashiCorp Vault holding the API token (e.g. secret/data/jenkins), read with VAULT_ADDR and VAULT_TOKEN"`
+	AWSSecretID                  string        `long:"aws-secret-id" description:"Name or ARN of the secret in AWS Secrets Manager holding the API token"`
+	SecretTokenKey               string        `long:"secret-token-key" default:"api_token" description:"Key of the API token in the secret"`
+	SecretUserKey                string        `long:"secret-user-key" default:"user" description:"Key of the user in the secret, used if present"`
+	SecretCacheFile              string        `long:"secret-cache-file" description:"File to keep the secret read from --vault-path or --aws-secret-id for --secret-cache-ttl"`
+	SecretCacheTTL               duration      `long:"secret-cache-ttl" default:"5m" description:"How long the secret in --secret-cache-file is used"`
+	IAPAudience                  string        `long:"iap-audience" description:"OAuth client ID of Google Identity-Aware Proxy in front of Jenkins, to send an ID token for"`
+	IAPCredentials               string        `long:"iap-credentials" description:"Service account key file to get the ID token for --iap-audience with, instead of the metadata server of GCE"`
+	BearerToken                  string        `long:"bearer-token" env:"JENKINS_BEARER_TOKEN" description:"Bearer token sent instead of basic auth"`
+	Negotiate                    bool          `long:"negotiate" description:"Authenticate with Kerberos SPNEGO"`
+	Krb5Config                   string        `long:"krb5-config" env:"KRB5_CONFIG" default:"/etc/krb5.conf" description:"Kerberos configuration file for --negotiate"`
+	Keytab                       string        `long:"keytab" description:"Keytab for --negotiate instead of the credential cache"`
+	Krb5Principal                string        `long:"krb5-principal" description:"Principal (user@REALM) to log in with --keytab"`
+	Netrc                        bool          `long:"netrc" description:"Read the user and API token from ~/.netrc unless they are given"`
+	NetrcFile                    string        `long:"netrc-file" description:"Netrc file to read instead of ~/.netrc (implies --netrc)"`
+	Completion                   string        `long:"completion" hidden:"true" choice:"bash" choice:"zsh" choice:"fish" description:"Print the completion script of the shell, and exit"`
+	Version                      bool          `long:"version" description:"Print the version, the commit and the build date, and exit"`
+	Input                        string        `long:"input" description:"Evaluate the API response of the job or the build saved in the file (- for stdin) instead of fetching it from Jenkins"`
+	DryRun                       bool          `long:"dry-run" description:"Print the API URLs and the thresholds to use, and exit OK without contacting Jenkins"`
+	OTelEndpoint                 string        `long:"otel-endpoint" description:"OTLP/HTTP endpoint of OpenTelemetry to export a span of each check run to (e.g. http://localhost:4318)"`
+	Verbose                      bool          `short:"v" long:"verbose" description:"Log requests to Jenkins with their headers, responses and timing to stderr"`
+	Timeout                      duration      `long:"timeout" description:"Timeout of each request to Jenkins including the connection (e.g. 10s)"`
+	MaxWait                      duration      `long:"max-wait" default:"10s" description:"Longest time in total to wait as Jenkins asks by Retry-After of 429 and 503 responses before retrying"`
+	MaxResponseBytes             int64         `long:"max-response-bytes" default:"67108864" description:"Largest response body to read from Jenkins after decompression, 0 for no limit"`
+	Retries                      int           `long:"retries" description:"Number of retries on connection errors, 429 and 5xx responses"`
+	RetryInterval                duration      `long:"retry-interval" default:"1s" description:"Interval before the first retry, doubled on each retry"`
+	StatusOnHTTPError            string        `long:"status-on-http-error" default:"unknown" choice:"unknown" choice:"critical" choice:"warning" description:"Status when Jenkins answers an HTTP error"`
+	UnixSocket                   string        `long:"unix-socket" description:"Connect to Jenkins through the unix domain socket"`
+	JobRegex                     string        `long:"job-regex" description:"Check every top-level job whose name matches the regular expression"`
+	Config                       string        `long:"config" description:"TOML file listing jobs with their own thresholds, flags are used as defaults"`
+	View                         string        `long:"view" description:"Check every job in the Jenkins view"`
+	WarningPercent               float64       `long:"warning-percent" description:"Trigger a warning if over the percentage of estimatedDuration, instead of the fixed threshold"`
+	CriticalPercent              float64       `long:"critical-percent" description:"Trigger a critical if over the percentage of estimatedDuration, instead of the fixed threshold"`
+	AutoThreshold                bool          `long:"auto-threshold" description:"Use mean + k * stddev of recent successful builds as thresholds"`
+	AutoBuilds                   int           `long:"auto-builds" default:"10" description:"Number of recent successful builds for --auto-threshold"`
+	AutoWarningK                 float64       `long:"auto-warning-k" default:"2" description:"k for the warning threshold with --auto-threshold"`
+	AutoCriticalK                float64       `long:"auto-critical-k" default:"3" description:"k for the critical threshold with --auto-threshold"`
+	Percentile                   float64       `long:"percentile" description:"Use the percentile (e.g. 95) of recent completed build durations times the multipliers as thresholds"`
+	PercentileWarningMultiplier  float64       `long:"percentile-warning-multiplier" default:"1" description:"Multiplier of the percentile for the warning threshold"`
+	PercentileCriticalMultiplier float64       `long:"percentile-critical-multiplier" default:"1.5" description:"Multiplier of the percentile for the critical threshold"`
+	IncludeCompleted             bool          `long:"include-completed" description:"Also alert on builds which completed recently but took over the thresholds"`
+	CompletedWithin              duration      `long:"completed-within" default:"1h" description:"Lookback window of completed builds for --include-completed"`
+	FailureWarning               int           `long:"failure-warning" description:"Trigger a warning if the number of failed builds in recent builds is the count or more"`
+	FailureCritical              int           `long:"failure-critical" description:"Trigger a critical if the number of failed builds in recent builds is the count or more"`
+	ConsecutiveFailuresCritical  int           `long:"consecutive-failures-critical" description:"Trigger a critical if the latest completed builds of the count all failed"`
+	SuccessRateWarning           float64       `long:"success-rate-warning" description:"Trigger a warning if the success rate of recent completed builds is below the percentage"`
+	SuccessRateCritical          float64       `long:"success-rate-critical" description:"Trigger a critical if the success rate of recent completed builds is below the percentage"`
+	LastSuccessWarning           duration      `long:"last-success-warning" description:"Trigger a warning if no build succeeded within the duration"`
+	LastSuccessCritical          duration      `long:"last-success-critical" description:"Trigger a critical if no build succeeded within the duration"`
+	NoBuildWithinWarning         duration      `long:"no-build-within-warning" description:"Trigger a warning if no build started within the duration"`
+	NoBuildWithinCritical        duration      `long:"no-build-within-critical" description:"Trigger a critical if no build started within the duration"`
+	UnknownAs                    string        `long:"unknown-as" default:"unknown" choice:"ok" choice:"warning" choice:"critical" choice:"unknown" description:"Status reported instead of UNKNOWN, e.g. critical for those paging on UNKNOWN"`
+	NetworkErrorAs               string        `long:"network-error-as" default:"unknown" choice:"ok" choice:"warning" choice:"critical" choice:"unknown" description:"Status when Jenkins cannot be reached, e.g. connection refused, timeouts and TLS errors"`
+	UnstableAs                   string        `long:"unstable-as" default:"ok" choice:"ok" choice:"warning" choice:"critical" description:"Status when the latest completed build is UNSTABLE"`
+	NoBuildsStatus               string        `long:"no-builds-status" default:"ok" choice:"ok" choice:"warning" choice:"critical" choice:"unknown" description:"Status when the job has no build at all, e.g. a pipeline never triggered"`
+	DisabledStatus               string        `long:"disabled-status" default:"ok" choice:"ok" choice:"warning" choice:"critical" description:"Status when the job is disabled"`
+	AbortedAs                    string        `long:"aborted-as" default:"ok" choice:"ok" choice:"warning" choice:"critical" description:"Status when the latest completed build is ABORTED"`
+	ExpectArtifacts              []string      `long:"expect-artifact" description:"Alert if no artifact of the last successful build matches the glob, by the relative path or the file name (repeatable)"`
+	MissingArtifactStatus        string        `long:"missing-artifact-status" default:"critical" choice:"warning" choice:"critical" description:"Status when an artifact of --expect-artifact is missing"`
+	TestFailWarning              int           `long:"test-fail-warning" description:"Trigger a warning if the count of failing tests of the last completed build reaches this"`
+	TestFailCritical             int           `long:"test-fail-critical" description:"Trigger a critical if the count of failing tests of the last completed build reaches this"`
+	TestSkipWarning              int           `long:"test-skip-warning" description:"Trigger a warning if the count of skipped tests of the last completed build reaches this"`
+	TestSkipCritical             int           `long:"test-skip-critical" description:"Trigger a critical if the count of skipped tests of the last completed build reaches this"`
+	SCMPollWarning               duration      `long:"scm-poll-warning" description:"Trigger a warning if SCM polling of the job has not run for the duration or its last run failed (e.g. 2h)"`
+	SCMPollCritical              duration      `long:"scm-poll-critical" description:"Trigger a critical if SCM polling of the job has not run for the duration or its last run failed (e.g. 6h)"`
+	JenkinsTimezone              string        `long:"jenkins-timezone" description:"Time zone of Jenkins the SCM polling log is written in, e.g. Asia/Tokyo (default: local)"`
+	QueueReason                  bool          `long:"queue-reason" description:"Append why the queue items of the job wait, e.g. for an executor of a label, to the message"`
+	CheckColor                   bool          `long:"check-color" description:"Check jobs by their color, i.e. the result of the last build, instead of the build time"`
+	ColorStatuses                []string      `long:"color-status" description:"Status of the color with --check-color in COLOR=STATUS, e.g. aborted=ok (repeatable, default: blue=ok, yellow=warning, red=critical, aborted=warning, notbuilt=ok, disabled by --disabled-status)"`
+	CheckQueue                   bool          `long:"check-queue" description:"Also alert on queue items of the job waiting over the thresholds"`
+	QueueWarning                 duration      `long:"queue-warning" description:"Threshold of waiting in the queue for a warning (default: the build warning threshold)"`
+	QueueCritical                duration      `long:"queue-critical" description:"Threshold of waiting in the queue for a critical (default: the build critical threshold)"`
+	CheckExecutors               bool          `long:"check-executors" description:"Check executor utilization of the instance instead of builds"`
+	Label                        string        `long:"label" description:"Agent label to check with --check-executors or --check-nodes (default: the whole instance)"`
+	CheckNodes                   bool          `long:"check-nodes" description:"Check that agents are online instead of builds"`
+	NodePattern                  string        `long:"node-pattern" default:"*" description:"Glob pattern of agent names to check with --check-nodes"`
+	ExecutorsWarning             float64       `long:"executors-warning" default:"80" description:"Trigger a warning if busy executors are over the percentage"`
+	QuietDown                    string        `long:"quiet-down" default:"off" choice:"off" choice:"ok" choice:"warning" choice:"ignore-thresholds" description:"Behavior while Jenkins is quieting down (off: not checked, ignore-thresholds: only build results are checked)"`
+	CheckHealth                  bool          `long:"check-health" description:"Check that Jenkins itself responds instead of builds"`
+	HealthPath                   string        `long:"health-path" default:"/api/json" description:"Path requested with --check-health (e.g. /login)"`
+	LatencyWarning               duration      `long:"latency-warning" default:"1s" description:"Trigger a warning with --check-health if the response takes the duration or more"`
+	LatencyCritical              duration      `long:"latency-critical" default:"5s" description:"Trigger a critical with --check-health if the response takes the duration or more"`
+	ExecutorsCritical            float64       `long:"executors-critical" default:"95" description:"Trigger a critical if busy executors are over the percentage"`
+	Multibranch                  bool          `long:"multibranch" description:"Check every branch job of the multibranch pipelines given by --job-name"`
+	IncludeBranch                []string      `long:"include-branch" description:"Glob pattern of branches to check with --multibranch (repeatable)"`
+	ExcludeBranch                []string      `long:"exclude-branch" description:"Glob pattern of branches not to check with --multibranch (repeatable)"`
+	SlowdownFactor               float64       `long:"slowdown-factor" description:"Trigger a warning if a running build takes over the factor (e.g. 2.0) times the previous successful build"`
+	StallDetect                  bool          `long:"stall-detect" description:"Trigger a critical if the console log of a running build over the warning threshold does not grow in --stall-window"`
+	StallWindow                  duration      `long:"stall-window" default:"10s" description:"How long to watch the console log with --stall-detect"`
+	ChainWarning                 duration      `long:"chain-warning" description:"Threshold of the newest build and the builds triggered downstream of it in total for a warning"`
+	ChainCritical                duration      `long:"chain-critical" description:"Threshold of the newest build and the builds triggered downstream of it in total for a critical"`
+	Stage                        string        `long:"stage" description:"Name of a pipeline stage to check the running duration of"`
+	StageWarning                 duration      `long:"stage-warning" description:"Threshold of the running stage given by --stage for a warning"`
+	StageCritical                duration      `long:"stage-critical" description:"Threshold of the running stage given by --stage for a critical"`
+	DetectPostBuild              bool          `long:"detect-postbuild" description:"Label pipeline builds whose stages completed but are still running as post-build stuck"`
+	Trend                        bool          `long:"trend" description:"Trigger a warning if durations of recent finished builds are increasing"`
+	TrendWindow                  int64         `long:"trend-window" default:"5" description:"Number of recent finished builds to inspect with --trend"`
+	TrendSlope                   float64       `long:"trend-slope" description:"Trigger a warning with --trend if the durations grow faster than the seconds per build"`
+	AverageWarning               duration      `long:"average-warning" description:"Trigger a warning if the average duration of recent finished builds is over the threshold"`
+	AverageCritical              duration      `long:"average-critical" description:"Trigger a critical if the average duration of recent finished builds is over the threshold"`
+	AverageWindow                int64         `long:"average-window" default:"5" description:"Number of recent finished builds to average with --average-warning and --average-critical"`
+	AverageMethod                string        `long:"average-method" default:"mean" choice:"mean" choice:"median" description:"How to average the durations of recent finished builds"`
 }
 
 /*
@@ -46,15 +228,20 @@ Jenkins api result contains build millisecond timestamp like this.
 }
 
 To decode the above format json, we define `jsonTime`.
+Some custom exporters emit seconds or nanoseconds instead, which is selected by `--timestamp-unit`.
 */
 
 type jsonTime time.Time
 
 func (t jsonTime) toTime() time.Time { return time.Time(t) }
+
+// MarshalJSON emits milliseconds as Jenkins does
 func (t jsonTime) MarshalJSON() ([]byte, error) {
-	return []byte(strconv.FormatInt(t.toTime().Unix(), 10)), nil
+	return []byte(strconv.FormatInt(t.toTime().UnixMilli(), 10)), nil
 }
 
+// UnmarshalJSON keeps the number as it is, as nanoseconds, since the unit is given by the options.
+// inUnit converts it once the response is decoded.
 func (t *jsonTime) UnmarshalJSON(s []byte) (err error) {
 	r := strings.Replace(string(s), `"`, ``, -1)
 
@@ -62,76 +249,1010 @@ func (t *jsonTime) UnmarshalJSON(s []byte) (err error) {
 	if err != nil {
 		return err
 	}
-	*(*time.Time)(t) = time.Unix(q/1000, 0)
+	*(*time.Time)(t) = time.Unix(0, q)
 	return
 }
 
+// inUnit converts the number kept by UnmarshalJSON on the unit of `--timestamp-unit`
+func (t jsonTime) inUnit(unit string) jsonTime {
+	q := t.toTime().UnixNano()
+	switch unit {
+	case "s":
+		return jsonTime(time.Unix(q, 0))
+	case "ns":
+		return jsonTime(time.Unix(0, q))
+	}
+	return jsonTime(time.UnixMilli(q))
+}
+
 func (t jsonTime) String() string { return t.toTime().String() }
 
 type build struct {
-	Number    int      `json:"number"`
-	Result    *string  `json:"result"`
-	Timestamp jsonTime `json:"timestamp"`
+	Number int     `json:"number"`
+	Result *string `json:"result"`
+	// Building is reported by every build, and InProgress by pipeline builds which may run stages after building
+	Building   *bool    `json:"building"`
+	InProgress *bool    `json:"inProgress"`
+	Timestamp  jsonTime `json:"timestamp"`
+	Duration   int64    `json:"duration"`
+	// EstimatedDuration is computed by Jenkins from recent builds, -1 if unknown
+	EstimatedDuration int64 `json:"estimatedDuration"`
+	// DisplayName and Actions are fetched only when they are needed, see buildTree
+	DisplayName string        `json:"displayName"`
+	Actions     []buildAction `json:"actions"`
+	// queued is the time in the queue excluded from elapsed times with `--exclude-queue-time`
+	queued time.Duration
 }
 
+// isUnfinished tells running builds by what Jenkins reports,
+// since builds lost in a crash of Jenkins keep the result null forever.
+// The result is looked at only for responses without the fields, e.g. of Blue Ocean.
 func (b build) isUnfinished() bool {
+	if b.InProgress != nil && *b.InProgress {
+		return true
+	}
+	if b.Building != nil {
+		return *b.Building
+	}
 	return b.Result == nil
 }
 
+// Jenkins reports build duration in milliseconds
+func (b build) duration() time.Duration {
+	return time.Duration(b.Duration) * time.Millisecond
+}
+
+// startedAt is when the build started, after waiting in the queue with `--exclude-queue-time`
+func (b build) startedAt() time.Time {
+	return b.Timestamp.toTime().Add(b.queued)
+}
+
+// executionTime is the duration of the finished build compared with the thresholds
+func (b build) executionTime() time.Duration {
+	return b.duration() - b.queued
+}
+
+func (b build) estimatedDuration() time.Duration {
+	return time.Duration(b.EstimatedDuration) * time.Millisecond
+}
+
+// buildFields is the tree selector for each build, see buildTree for the extended one
+const buildFields = "result,building,inProgress,number,timestamp,duration,estimatedDuration"
+
+// jobFields is the tree selector for the job itself
+const jobFields = "lastSuccessfulBuild[number,timestamp,duration],buildable,disabled"
+
 type builds struct {
-	Builds []build `json:"builds"`
+	Builds              []build `json:"builds"`
+	LastSuccessfulBuild *build  `json:"lastSuccessfulBuild"`
+	jobState
+}
+
+// jobState is whether the job can be built.
+// Disabled is reported by freestyle jobs and pipelines, Buildable by every job.
+type jobState struct {
+	Buildable *bool `json:"buildable"`
+	Disabled  *bool `json:"disabled"`
+}
+
+// known reports whether the response had the fields
+func (s jobState) known() bool {
+	return s.Buildable != nil || s.Disabled != nil
+}
+
+func (s jobState) isDisabled() bool {
+	if s.Disabled != nil {
+		return *s.Disabled
+	}
+	return s.Buildable != nil && !*s.Buildable
+}
+
+// isDisabled reports whether the job is disabled, fetching the state unless it came with the builds
+func (c *Client) isDisabled(ctx context.Context, t target, bs builds) (bool, error) {
+	if bs.known() || c.opts.Input != "" {
+		return bs.isDisabled(), nil
+	}
+	var s jobState
+	if err := c.fetchJobJSON(ctx, t, "/api/json?tree=buildable,disabled", &s); err != nil {
+		return false, err
+	}
+	return s.isDisabled(), nil
+}
+
+const checkerName = "JenkinsBuildTime"
+
+// checkName is the name of the checker in the output, `--check-name` or JenkinsBuildTime-<job> for a single job
+// so that checks of different jobs are told apart
+func (o *Options) checkName() string {
+	if o.CheckName != "" {
+		return o.CheckName
+	}
+	if o.isSingleJob() && len(o.JobNames) == 1 {
+		return checkerName + "-" + o.JobNames[0]
+	}
+	return checkerName
+}
+
+// version, commit and date are set on release by -ldflags "-X github.com/syou6162/check-jenkins-build-time/lib.version=..."
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// versionString describes the build for `--version`.
+// The commit falls back to the one Go records in the binary when it is built from the repository.
+func versionString() string {
+	rev, built := commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && rev == "":
+				rev = s.Value
+			case s.Key == "vcs.time" && built == "":
+				built = s.Value
+			}
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+	return fmt.Sprintf("check-jenkins-build-time %s (commit %s, built %s)", version, rev, built)
 }
 
 // Do the plugin
 func Do() {
-	ckr := run(os.Args[1:])
-	ckr.Name = "JenkinsBuildTime"
-	ckr.Exit()
+	opts := parseArgs(os.Args[1:])
+	c := NewClient(opts)
+	if opts.DryRun {
+		ckr := c.dryRun(os.Stdout)
+		ckr.Name = opts.checkName()
+		fmt.Println(ckr.String())
+		os.Exit(opts.exitCode(ckr.Status))
+	}
+	// Ctrl-C or SIGTERM cancels the requests in flight, and stops --watch and --serve
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if opts.Serve != "" {
+		if err := c.serve(ctx, opts.Serve); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if opts.Watch {
+		c.watch(ctx, opts.Interval.Duration())
+		return
+	}
+	if opts.Metric {
+		if err := c.printMetrics(ctx, os.Getenv("MACKEREL_AGENT_PLUGIN_META") != ""); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	ckr, results := c.run(ctx)
+	ckr.Name = opts.checkName()
+	c.notifyChange(ckr)
+	if opts.Exec != "" && ckr.Status != checkers.OK {
+		execHook(opts.Exec, ckr)
+	}
+	if opts.Syslog {
+		if err := writeSyslog(ckr); err != nil {
+			log.Printf("Failed to write syslog: %s", err)
+		}
+	}
+	if err := c.printResult(ckr, results); err != nil {
+		log.Printf("Failed to print the result: %s", err)
+	}
+	if opts.Format == "sensu" {
+		if opts.SensuAgentAPI != "" {
+			if err := c.sendSensuEvent(ckr, results); err != nil {
+				log.Printf("Failed to send the event to Sensu: %s", err)
+			}
+		}
+		// Sensu Go tells the status only by the exit code of the conventions of Nagios
+		os.Exit(statusValue(ckr.Status))
+	}
+	os.Exit(opts.exitCode(ckr.Status))
 }
 
-func filterUnfinishedTooLongBuilds(builds []build, threshold time.Duration) []build {
-	now := time.Now()
+// parseStatus converts a status name given by flags into checkers.Status
+func parseStatus(s string) checkers.Status {
+	switch strings.ToLower(s) {
+	case "ok":
+		return checkers.OK
+	case "warning":
+		return checkers.WARNING
+	case "critical":
+		return checkers.CRITICAL
+	}
+	return checkers.UNKNOWN
+}
+
+func (o *Options) exitCode(st checkers.Status) int {
+	switch st {
+	case checkers.OK:
+		return o.OkCode
+	case checkers.WARNING:
+		return o.WarningCode
+	case checkers.CRITICAL:
+		return o.CriticalCode
+	}
+	return o.UnknownCode
+}
+
+func filterUnfinishedTooLongBuilds(builds []build, now time.Time, threshold thresholdFunc) []build {
+	ret := make([]build, 0)
+
+	for _, b := range builds {
+		if b.isUnfinished() && now.Sub(b.startedAt()) > threshold(b) {
+			ret = append(ret, b)
+		}
+	}
+	return ret
+}
+
+// filterRecentlyCompletedTooLongBuilds returns finished builds which completed within `lookback` and took over the threshold
+func filterRecentlyCompletedTooLongBuilds(builds []build, now time.Time, threshold thresholdFunc, lookback time.Duration) []build {
 	ret := make([]build, 0)
 
 	for _, b := range builds {
-		if b.isUnfinished() && now.Sub(b.Timestamp.toTime()) > threshold {
+		if b.isUnfinished() {
+			continue
+		}
+		completedAt := b.Timestamp.toTime().Add(b.duration())
+		if now.Sub(completedAt) <= lookback && b.executionTime() > threshold(b) {
 			ret = append(ret, b)
 		}
 	}
 	return ret
 }
 
-func run(args []string) *checkers.Checker {
-	_, err := flags.ParseArgs(&opts, args)
+// oldestUnfinished returns the unfinished build started first, or nothing if all builds finished
+func oldestUnfinished(builds []build) []build {
+	var oldest *build
+	for i, b := range builds {
+		if b.isUnfinished() && (oldest == nil || b.Timestamp.toTime().Before(oldest.Timestamp.toTime())) {
+			oldest = &builds[i]
+		}
+	}
+	if oldest == nil {
+		return nil
+	}
+	return []build{*oldest}
+}
+
+func countUnfinished(builds []build) int {
+	n := 0
+	for _, b := range builds {
+		if b.isUnfinished() {
+			n++
+		}
+	}
+	return n
+}
+
+// checkRunningCount alerts on too many builds running at once, which often means a stuck lock or runaway triggers
+func (c *Client) checkRunningCount(builds []build) *checkers.Checker {
+	n := countUnfinished(builds)
+	msg := fmt.Sprintf("%d builds are running at once", n)
+	if c.opts.RunningCritical > 0 && n >= c.opts.RunningCritical {
+		return checkers.Critical(msg)
+	}
+	if c.opts.RunningWarning > 0 && n >= c.opts.RunningWarning {
+		return checkers.Warning(msg)
+	}
+	return nil
+}
+
+// previousSuccess returns the newest successful build before the build, falling back to lastSuccessfulBuild beyond the recent builds
+func previousSuccess(bs builds, b build) *build {
+	for i, prev := range bs.Builds {
+		if prev.Number < b.Number && prev.hasResult("SUCCESS") {
+			return &bs.Builds[i]
+		}
+	}
+	if l := bs.LastSuccessfulBuild; l != nil && l.Number < b.Number {
+		return l
+	}
+	return nil
+}
+
+// checkSlowdown warns on running builds taking longer than `--slowdown-factor` times the previous successful build,
+// catching sudden slowdowns without absolute thresholds
+func (c *Client) checkSlowdown(t target, bs builds) *checkers.Checker {
+	if c.opts.SlowdownFactor <= 0 {
+		return nil
+	}
+	for _, b := range bs.Builds {
+		if !b.isUnfinished() {
+			continue
+		}
+		prev := previousSuccess(bs, b)
+		if prev == nil {
+			continue
+		}
+		elapsed := c.now().Sub(b.startedAt())
+		limit := time.Duration(c.opts.SlowdownFactor * float64(prev.executionTime()))
+		if elapsed > limit {
+			return checkers.Warning(fmt.Sprintf("Build id = %d takes %s, over %g times the previous successful build id = %d (%s) %s",
+				b.Number, elapsed.Round(time.Second), c.opts.SlowdownFactor, prev.Number, prev.executionTime().Round(time.Second), c.buildURL(t, b)))
+		}
+	}
+	return nil
+}
+
+// totalElapsed returns the sum of elapsed times of unfinished builds
+func totalElapsed(builds []build, now time.Time) time.Duration {
+	var total time.Duration
+	for _, b := range builds {
+		if b.isUnfinished() {
+			total += now.Sub(b.startedAt())
+		}
+	}
+	return total
+}
+
+// recentSuccessfulDurations returns durations of the latest `n` successful builds
+func recentSuccessfulDurations(builds []build, n int) []time.Duration {
+	ret := make([]time.Duration, 0, n)
+	for _, b := range builds {
+		if len(ret) >= n {
+			break
+		}
+		if b.Result != nil && *b.Result == "SUCCESS" {
+			ret = append(ret, b.executionTime())
+		}
+	}
+	return ret
+}
+
+// recentFinishedDurations returns durations of the latest `n` finished builds in chronological order.
+// Jenkins returns builds from newest to oldest.
+func recentFinishedDurations(builds []build, n int) []time.Duration {
+	ret := make([]time.Duration, 0, n)
+	for _, b := range builds {
+		if len(ret) >= n {
+			break
+		}
+		if !b.isUnfinished() {
+			ret = append(ret, b.executionTime())
+		}
+	}
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret
+}
+
+// isIncreasingTrend reports whether durations are strictly increasing, or,
+// when slope is positive, whether their least-squares slope exceeds slope seconds per build.
+func isIncreasingTrend(durations []time.Duration, slope float64) bool {
+	if len(durations) < 2 {
+		return false
+	}
+	if slope > 0 {
+		return durationSlope(durations) > slope
+	}
+	for i := 1; i < len(durations); i++ {
+		if durations[i] <= durations[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// durationSlope returns the least-squares slope of durations in seconds per build
+func durationSlope(durations []time.Duration) float64 {
+	n := float64(len(durations))
+	var sumX, sumY, sumXY, sumXX float64
+	for i, d := range durations {
+		x := float64(i)
+		y := d.Seconds()
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+}
+
+// checkBuild compares the elapsed time of the running build or the duration of the finished build with the thresholds
+func (c *Client) checkBuild(t target, b build) *checkers.Checker {
+	warning, critical := c.thresholdFuncs(t, []build{b})
+	elapsed := b.executionTime()
+	msg := fmt.Sprintf("%s took %s", c.buildLabel(b), elapsed)
+	if b.isUnfinished() {
+		elapsed = c.now().Sub(b.startedAt())
+		msg = fmt.Sprintf("%s has been running for %s", c.buildLabel(b), elapsed.Round(time.Second))
+	}
+	msg += " " + c.buildURL(t, b)
+	switch {
+	case elapsed > critical(b):
+		return checkers.Critical(msg)
+	case elapsed > warning(b):
+		return checkers.Warning(msg)
+	}
+	return checkers.Ok(msg)
+}
+
+// buildURL returns the page of the build to click through from alerts
+func (c *Client) buildURL(t target, b build) string {
+	return c.jobURL(t.job, fmt.Sprintf("/%d/", b.Number))
+}
+
+func (c *Client) tookTooLongMessage(b build, threshold time.Duration) string {
+	return fmt.Sprintf("%s took too long time (%s > %s)", c.buildLabel(b), b.executionTime(), threshold)
+}
+
+func (c *Client) tooLongMessage(ctx context.Context, t target, b build, threshold time.Duration) string {
+	elapsed := c.now().Sub(b.startedAt()).Round(time.Second)
+	msg := fmt.Sprintf("%s takes too long time (%s > %s)", c.buildLabel(b), elapsed, threshold)
+	if c.opts.DetectPostBuild && c.isPostBuildStuck(ctx, t, b) {
+		msg += " (stuck in post-build)"
+	}
+	return msg
+}
+
+// parseFlags overrides the options given in args, leaving the others as they are in opts
+func parseFlags(opts *Options, args []string, parserOpts flags.Options) error {
+	var given Options
+	parser := flags.NewParser(&given, parserOpts)
+	if _, err := parser.ParseArgs(args); err != nil {
+		return err
+	}
+	isSet := func(longName string) bool {
+		o := parser.FindOptionByLongName(longName)
+		return o != nil && o.IsSet() && !o.IsSetDefault()
+	}
+	dst, src := reflect.ValueOf(opts).Elem(), reflect.ValueOf(given)
+	for i := 0; i < src.NumField(); i++ {
+		if isSet(src.Type().Field(i).Tag.Get("long")) {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	if len(opts.JobNames) == 0 && os.Getenv("JENKINS_JOB_NAME") != "" {
+		opts.JobNames = []string{os.Getenv("JENKINS_JOB_NAME")}
+	}
+	if _, _, err := resolveThresholds(opts, isSet); err != nil {
+		return &thresholdError{err}
+	}
+	return nil
+}
+
+// thresholdError is returned by parseFlags for thresholds which conflict, reported as UNKNOWN rather than a usage error
+type thresholdError struct {
+	err error
+}
+
+func (e *thresholdError) Error() string {
+	return fmt.Sprintf("Invalid thresholds: %s", e.err)
+}
+
+// validate rejects combinations of options which cannot work together
+func (o *Options) validate() error {
+	if o.Input != "" {
+		if len(o.JobNames) > 1 || o.JobsFile != "" || o.JobRegex != "" || o.View != "" || o.Config != "" || o.Multibranch || o.isInstanceCheck() {
+			return errors.New("--input evaluates one job, given by --job-name at most")
+		}
+	} else if !o.hasJobSelector() && !o.isInstanceCheck() {
+		return errors.New("the required flag `-j, --job-name' was not specified")
+	}
+	for _, h := range o.Headers {
+		if _, _, ok := splitHeader(h); !ok {
+			return fmt.Errorf("invalid header %q, expected 'Name: value'", h)
+		}
+	}
+	for _, p := range append(append([]string{}, o.Params...), o.ExcludeParams...) {
+		if _, _, ok := splitParam(p); !ok {
+			return fmt.Errorf("invalid parameter filter %q, expected KEY=VALUE", p)
+		}
+	}
+	if o.NotifyWebhook != "" && o.StateFile == "" && !o.Watch && o.Serve == "" {
+		return errors.New("--notify-webhook requires --state-file to know the previous status")
+	}
+	if o.AlertOnce && o.StateFile == "" {
+		return errors.New("--alert-once requires --state-file")
+	}
+	if o.Output == "json" && o.Format != "mackerel" {
+		return errors.New("--output=json and --format are exclusive")
+	}
+	if o.SensuAgentAPI != "" && o.Format != "sensu" {
+		return errors.New("--sensu-agent-api requires --format=sensu")
+	}
+	if o.OutputFile != "" && o.Format != "prometheus" {
+		return errors.New("--output-file requires --format=prometheus")
+	}
+	if o.CheckColor && o.Input != "" {
+		return errors.New("--check-color and --input are exclusive")
+	}
+	for _, cs := range o.ColorStatuses {
+		if k, v, ok := splitParam(cs); !ok || k == "" || (parseStatus(v) == checkers.UNKNOWN && !strings.EqualFold(v, "unknown")) {
+			return fmt.Errorf("invalid color status %q, expected COLOR=ok|warning|critical|unknown", cs)
+		}
+	}
+	for _, g := range o.ExpectArtifacts {
+		if _, err := path.Match(g, ""); err != nil {
+			return fmt.Errorf("invalid artifact glob %q: %s", g, err)
+		}
+	}
+	if o.JenkinsTimezone != "" {
+		if _, err := time.LoadLocation(o.JenkinsTimezone); err != nil {
+			return fmt.Errorf("invalid time zone of Jenkins: %s", err)
+		}
+	}
+	if o.MessageTemplate != "" {
+		if _, err := parseMessageTemplate(o.MessageTemplate); err != nil {
+			return fmt.Errorf("invalid message template: %s", err)
+		}
+	}
+	if o.API == "blueocean" && (o.ScanAll || o.AllBuilds) {
+		return errors.New("--scan-all and --all-builds are not supported with --api=blueocean")
+	}
+	if o.API == "blueocean" && (o.BuildNumber > 0 || o.LastBuildOnly) {
+		return errors.New("--build-number and --last-build-only are not supported with --api=blueocean")
+	}
+	return nil
+}
+
+// parseArgs returns the options of the command line, exiting on errors as a command
+func parseArgs(args []string) Options {
+	opts, err := NewOptions()
+	if err == nil {
+		err = parseFlags(&opts, args, flags.Default)
+	}
+	if opts.Version {
+		fmt.Println(versionString())
+		os.Exit(0)
+	}
+	if opts.Completion != "" {
+		if err := writeCompletion(os.Stdout, opts.Completion); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if e, ok := err.(*thresholdError); ok {
+		ckr := checkers.Unknown(e.Error())
+		ckr.Name = opts.checkName()
+		fmt.Println(ckr)
+		os.Exit(opts.exitCode(ckr.Status))
+	}
 	if err != nil {
+		// go-flags has printed the error
 		os.Exit(1)
 	}
+	if err := opts.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return opts
+}
 
+// Run checks once with opts, overridden by the flags in args as on the command line.
+// Reporting the result, e.g. printing it or --exec, is left to the caller.
+func Run(opts Options, args []string, options ...ClientOption) *checkers.Checker {
+	ckr := runWithArgs(&opts, args, options)
+	ckr.Name = opts.checkName()
+	return ckr
+}
+
+func runWithArgs(opts *Options, args []string, options []ClientOption) *checkers.Checker {
+	if err := parseFlags(opts, args, flags.PassDoubleDash); err != nil {
+		if e, ok := err.(*thresholdError); ok {
+			return checkers.Unknown(e.Error())
+		}
+		return checkers.Unknown(fmt.Sprintf("Invalid flags: %s", err))
+	}
+	if err := opts.validate(); err != nil {
+		return checkers.Unknown(fmt.Sprintf("Invalid flags: %s", err))
+	}
+	ckr, _ := NewClient(*opts, options...).run(context.Background())
+	return ckr
+}
+
+// truncateMessage cuts msg down to n characters ending with an ellipsis
+func truncateMessage(msg string, n int) string {
+	r := []rune(msg)
+	if n <= 0 || len(r) <= n {
+		return msg
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// run returns the result to report along with the results of each job
+func (c *Client) run(ctx context.Context) (*checkers.Checker, []jobResult) {
+	start := time.Now()
+	ckr, results := c.check(ctx)
+	ckr = c.mute(c.unknownAs(ckr))
+	ckr.Message = truncateMessage(ckr.Message, c.opts.MaxMessageLen)
+	if c.opts.OTelEndpoint != "" {
+		if err := c.exportTrace(start, ckr, results); err != nil {
+			log.Printf("Failed to export the trace: %s", err)
+		}
+	}
+	return ckr, results
+}
+
+func (c *Client) check(ctx context.Context) (*checkers.Checker, []jobResult) {
+	if err := c.setupClient(); err != nil {
+		return checkers.Unknown(fmt.Sprintf("Failed to set up HTTP client: %s", err)), nil
+	}
+	if err := c.refreshCredentials(ctx); err != nil {
+		return checkers.Unknown(fmt.Sprintf("Failed to get the credentials: %s", err)), nil
+	}
+	if c.opts.CheckExecutors {
+		return c.checkExecutors(ctx), nil
+	}
+	if c.opts.CheckNodes {
+		return c.checkNodes(ctx), nil
+	}
+	if c.opts.CheckHealth {
+		return c.checkHealth(ctx), nil
+	}
+	warning, critical, err := c.thresholds()
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Invalid thresholds: %s", err)), nil
+	}
+	if c.opts.Input != "" {
+		r := c.checkJob(ctx, c.inputTarget(warning, critical))
+		return c.unknownAs(r.checker), []jobResult{r}
+	}
+	if c.opts.QuietDown != "off" {
+		quieting, err := c.isQuietingDown(ctx)
+		if err != nil {
+			return c.fetchErrorChecker(err), nil
+		}
+		switch {
+		case quieting && c.opts.QuietDown == "ok":
+			return checkers.Ok("Jenkins is quieting down"), nil
+		case quieting && c.opts.QuietDown == "warning":
+			return checkers.Warning("Jenkins is quieting down"), nil
+		}
+		c.ignoreThresholds = quieting && c.opts.QuietDown == "ignore-thresholds"
+	}
+	targets, err := c.targetJobs(ctx, warning, critical)
+	if err != nil {
+		return c.fetchErrorChecker(err), nil
+	}
+	results := c.checkJobs(ctx, targets, int(c.opts.Concurrency))
+	if c.opts.StateFile != "" {
+		if err := c.rememberAlerts(c.opts.StateFile, results); err != nil {
+			return checkers.Unknown(fmt.Sprintf("Failed to update the state file: %s", err)), nil
+		}
+	}
+	if c.opts.isSingleJob() {
+		return results[0].checker, results
+	}
+	return aggregate(results), results
+}
+
+// fetchLastBuild returns only the newest build, or no build if the job has never run
+func (c *Client) fetchLastBuild(ctx context.Context, t target) (builds, error) {
+	var b build
+	err := c.fetchJobJSON(ctx, t, c.buildsPath(t), &b)
+	if e, ok := err.(*httpStatusError); ok && e.code == http.StatusNotFound {
+		return builds{Builds: []build{}}, nil
+	}
+	if err != nil {
+		return builds{}, err
+	}
+	return builds{Builds: []build{b}}, nil
+}
+
+// fetchLastSuccessfulBuild returns the last successful build of the job, or nil if no build has succeeded
+func (c *Client) fetchLastSuccessfulBuild(ctx context.Context, t target) (*build, error) {
+	var bs builds
+	if err := c.fetchJobJSON(ctx, t, "/api/json?tree=lastSuccessfulBuild[number,timestamp,duration]", &bs); err != nil {
+		return nil, err
+	}
+	return bs.LastSuccessfulBuild, nil
+}
+
+// buildsPath returns the path under the job URL which fetchBuilds requests first
+func (c *Client) buildsPath(t target) string {
+	switch {
+	case c.opts.BuildNumber > 0:
+		return fmt.Sprintf("/%d/api/json?tree=%s", c.opts.BuildNumber, c.buildTree(t))
+	case c.opts.LastBuildOnly:
+		return "/lastBuild/api/json?tree=" + c.buildTree(t)
+	case c.opts.ScanAll || c.opts.AllBuilds:
+		return "/api/json?tree=" + jobFields
+	}
 	// Jenkins does not provide api to get recent builds that does not finished yet.
 	// Instead, we check recent `MaxJobNumber` jobs, and filter unfinished and taking too long time jobs
-	url := fmt.Sprintf("%s://%s:%d/job/%s/api/json?tree=builds[result,number,timestamp]{,%d}", opts.Scheme, opts.Host, opts.Port, opts.JobName, opts.MaxJobNumber)
-	resp, err := http.Get(url)
+	return fmt.Sprintf("/api/json?tree=builds[%s]{,%d},%s", c.buildTree(t), t.maxJobNumber, jobFields)
+}
 
-	if err != nil {
-		return checkers.Unknown(fmt.Sprintf("Faild to fetch jenkins metrics: %s", err))
+// fetchBuilds returns builds of the job from newest to oldest
+func (c *Client) fetchBuilds(ctx context.Context, t target) (builds, error) {
+	if c.opts.Input != "" {
+		return c.readInputBuilds()
+	}
+	if c.opts.BuildNumber > 0 || c.opts.LastBuildOnly {
+		var bs builds
+		var err error
+		if c.opts.BuildNumber > 0 {
+			var b build
+			err = c.fetchJobJSON(ctx, t, c.buildsPath(t), &b)
+			bs = builds{Builds: []build{b}}
+		} else {
+			bs, err = c.fetchLastBuild(ctx, t)
+		}
+		// The response of a build does not tell the last successful build of the job
+		if err == nil && (c.opts.LastSuccessWarning > 0 || c.opts.LastSuccessCritical > 0) {
+			bs.LastSuccessfulBuild, err = c.fetchLastSuccessfulBuild(ctx, t)
+		}
+		return c.normalizeBuilds(bs), err
 	}
-	defer resp.Body.Close()
 	var builds builds
+	if c.opts.API == "blueocean" {
+		return c.fetchBlueBuilds(ctx, t)
+	}
+	if c.opts.ScanAll || c.opts.AllBuilds {
+		if err := c.fetchJobJSON(ctx, t, c.buildsPath(t), &builds); err != nil {
+			return builds, err
+		}
+		// --all-builds stops at `MaxJobNumber` builds, which may be over the limit of the `builds` element
+		limit := 0
+		if !c.opts.ScanAll {
+			limit = int(t.maxJobNumber)
+		}
+		var err error
+		builds.Builds, err = c.scanAllBuilds(ctx, t, int(c.opts.ScanPageSize), int(c.opts.ScanConcurrency), limit)
+		return c.normalizeBuilds(builds), err
+	}
+	path := c.buildsPath(t)
+	if err := c.fetchJobJSON(ctx, t, path, &builds); err != nil {
+		return builds, err
+	}
+	// `builds` stays nil only when the key is absent (or null), an empty history decodes to an empty slice
+	if c.opts.StrictSchema && builds.Builds == nil {
+		return builds, fmt.Errorf("the response of %s does not contain builds", c.jobURL(t.job, path))
+	}
+	return c.normalizeBuilds(builds), nil
+}
 
-	json.NewDecoder(resp.Body).Decode(&builds)
+// normalizeBuilds applies `--timestamp-unit` and `--exclude-queue-time` to the decoded builds
+func (c *Client) normalizeBuilds(bs builds) builds {
+	for i := range bs.Builds {
+		bs.Builds[i] = c.normalizeBuild(bs.Builds[i])
+	}
+	if bs.LastSuccessfulBuild != nil {
+		b := c.normalizeBuild(*bs.LastSuccessfulBuild)
+		bs.LastSuccessfulBuild = &b
+	}
+	return bs
+}
+
+func (c *Client) normalizeBuild(b build) build {
+	b.Timestamp = b.Timestamp.inUnit(c.opts.TimestampUnit)
+	if c.opts.ExcludeQueueTime {
+		b.queued = b.queueTime()
+	}
+	return b
+}
+
+// checkJob checks the job, keeping the builds over the thresholds and the evaluation of each build
+func (c *Client) checkJob(ctx context.Context, t target) jobResult {
+	if c.opts.CheckColor {
+		return c.checkColor(ctx, t)
+	}
+	bs, err := c.fetchBuilds(ctx, t)
+	if err != nil && c.opts.CacheFile != "" && isTransientError(err) {
+		if cached, at, ok := c.cachedBuilds(t); ok {
+			r := c.evaluateJob(ctx, t, cached)
+			r.checker = checkers.NewChecker(r.checker.Status, fmt.Sprintf("%s (checked on builds cached %s ago: %s)", r.checker.Message, c.now().Sub(at).Round(time.Second), c.fetchErrorChecker(err).Message))
+			return r
+		}
+	}
+	if err != nil {
+		return jobResult{job: t.job, checker: c.fetchErrorChecker(err), err: err}
+	}
+	if c.opts.CacheFile != "" {
+		if err := c.cacheBuilds(t, bs); err != nil {
+			log.Printf("Failed to update the cache file: %s", err)
+		}
+	}
+	return c.evaluateJob(ctx, t, bs)
+}
 
+// evaluateJob checks the builds fetched for the target
+func (c *Client) evaluateJob(ctx context.Context, t target, bs builds) jobResult {
+	r := jobResult{job: t.job}
+	if c.opts.DisabledStatus != "ok" {
+		disabled, err := c.isDisabled(ctx, t, bs)
+		if err != nil {
+			r.checker, r.err = c.fetchErrorChecker(err), err
+			return r
+		}
+		if disabled {
+			r.checker = checkers.NewChecker(parseStatus(c.opts.DisabledStatus), "The job is disabled")
+			return r
+		}
+	}
+	if len(bs.Builds) == 0 && c.opts.NoBuildsStatus != "ok" {
+		r.checker = checkers.NewChecker(parseStatus(c.opts.NoBuildsStatus), "The job has no build")
+		return r
+	}
+	bs.Builds = c.selectBuilds(t, bs.Builds)
+	r.evaluations = c.evaluateBuilds(t, bs.Builds)
+	if c.ignoreThresholds {
+		r.checker = withAlerts(checkers.Ok("Jenkins is quieting down, durations are not checked"), c.checkResults(bs))
+		return r
+	}
+	if c.opts.BuildNumber > 0 {
+		if len(bs.Builds) == 0 {
+			r.checker = checkers.Ok(fmt.Sprintf("Build id = %d is not checked by the filters", c.opts.BuildNumber))
+			return r
+		}
+		r.checker, r.builds = withAlerts(c.checkBuild(t, bs.Builds[0]), c.checkResults(bs)), []int{bs.Builds[0].Number}
+		return r
+	}
+	r.checker, r.builds = c.checkDurations(ctx, t, bs.Builds)
+	alerts := []*checkers.Checker{c.checkResults(bs), c.checkRunningCount(bs.Builds), c.checkSlowdown(t, bs)}
+	if c.opts.CheckQueue {
+		alerts = append(alerts, c.checkQueue(ctx, t))
+	}
+	if c.opts.Stage != "" {
+		alerts = append(alerts, c.checkStage(ctx, t, bs.Builds))
+	}
+	if c.opts.StallDetect {
+		alerts = append(alerts, c.checkStall(ctx, t, bs.Builds))
+	}
+	if c.opts.ChainWarning > 0 || c.opts.ChainCritical > 0 {
+		alerts = append(alerts, c.checkChain(ctx, t, bs.Builds))
+	}
+	if len(c.opts.ExpectArtifacts) > 0 {
+		alerts = append(alerts, c.checkArtifacts(ctx, t))
+	}
+	if c.opts.hasTestThresholds() {
+		alerts = append(alerts, c.checkTests(ctx, t))
+	}
+	if c.opts.SCMPollWarning > 0 || c.opts.SCMPollCritical > 0 {
+		alerts = append(alerts, c.checkPolling(ctx, t))
+	}
+	r.checker = withAlerts(r.checker, alerts...)
+	if c.opts.QueueReason {
+		r.checker = c.withQueueReason(ctx, t, r.checker)
+	}
+	return r
+}
+
+func (c *Client) checkDurations(ctx context.Context, t target, bs []build) (*checkers.Checker, []int) {
+	builds := builds{Builds: bs}
 	checkSt := checkers.OK
 
-	for _, b := range filterUnfinishedTooLongBuilds(builds.Builds, time.Second*time.Duration(opts.CritSecond)) {
-		checkSt = checkers.CRITICAL
-		msg := fmt.Sprintf("Build id = %d takes too long time", b.Number)
-		return checkers.NewChecker(checkSt, msg)
+	candidates := builds.Builds
+	if c.opts.OldestOnly {
+		candidates = oldestUnfinished(builds.Builds)
 	}
 
-	for _, b := range filterUnfinishedTooLongBuilds(builds.Builds, time.Second*time.Duration(opts.WarningSecond)) {
-		checkSt = checkers.WARNING
-		msg := fmt.Sprintf("Build id = %d takes too long time", b.Number)
-		return checkers.NewChecker(checkSt, msg)
+	warning, critical := c.thresholdFuncs(t, builds.Builds)
+	now := c.now()
+
+	// Every offending build is reported, those over the critical threshold first
+	offending := make([]string, 0)
+	numbers := make([]int, 0)
+	reported := make(map[int]bool)
+	report := func(st checkers.Status, b build, threshold time.Duration, msg string) {
+		if reported[b.Number] {
+			return
+		}
+		reported[b.Number] = true
+		numbers = append(numbers, b.Number)
+		full := msg
+		if checkSt == checkers.OK {
+			checkSt = st
+		} else if st != checkSt {
+			full += fmt.Sprintf(" (%s)", strings.ToLower(st.String()))
+		}
+		full += " " + c.buildURL(t, b)
+		if c.opts.MessageTemplate != "" {
+			full = c.renderMessage(t, b, st, threshold, full)
+		}
+		offending = append(offending, full)
+	}
+	for _, b := range filterUnfinishedTooLongBuilds(candidates, now, critical) {
+		report(checkers.CRITICAL, b, critical(b), c.tooLongMessage(ctx, t, b, critical(b)))
+	}
+	if c.opts.IncludeCompleted {
+		for _, b := range filterRecentlyCompletedTooLongBuilds(builds.Builds, now, critical, c.opts.CompletedWithin.Duration()) {
+			report(checkers.CRITICAL, b, critical(b), c.tookTooLongMessage(b, critical(b)))
+		}
+	}
+	for _, b := range filterUnfinishedTooLongBuilds(candidates, now, warning) {
+		if reported[b.Number] {
+			// Already reported as critical, which saves fetching the stages of the build again
+			continue
+		}
+		report(checkers.WARNING, b, warning(b), c.tooLongMessage(ctx, t, b, warning(b)))
 	}
-	return checkers.NewChecker(checkSt, "No build that takes too long time exists")
-}
\ No newline at end of file
+	if c.opts.IncludeCompleted {
+		for _, b := range filterRecentlyCompletedTooLongBuilds(builds.Builds, now, warning, c.opts.CompletedWithin.Duration()) {
+			report(checkers.WARNING, b, warning(b), c.tookTooLongMessage(b, warning(b)))
+		}
+	}
+	// Every enabled check is evaluated so that e.g. a warning of the trend does not hide a critical average
+	var alerts []*checkers.Checker
+	if len(offending) > 0 {
+		alerts = append(alerts, checkers.NewChecker(checkSt, strings.Join(offending, ", ")))
+	}
+
+	if c.opts.ExpectRunning != "" && countUnfinished(builds.Builds) == 0 {
+		alerts = append(alerts, checkers.NewChecker(parseStatus(c.opts.ExpectRunning), "No build is running"))
+	}
+
+	if c.opts.AggregateSecond > 0 {
+		total := totalElapsed(builds.Builds, now)
+		if total > c.opts.AggregateSecond.Duration() {
+			alerts = append(alerts, checkers.Warning(fmt.Sprintf("Running builds take %s in total", total)))
+		}
+	}
+
+	if c.opts.Trend {
+		durations := recentFinishedDurations(builds.Builds, int(c.opts.TrendWindow))
+		if isIncreasingTrend(durations, c.opts.TrendSlope) {
+			msg := fmt.Sprintf("Durations of recent %d builds are increasing (latest: %s)", len(durations), durations[len(durations)-1])
+			alerts = append(alerts, checkers.Warning(msg))
+		}
+	}
+
+	if c.opts.AverageWarning > 0 || c.opts.AverageCritical > 0 {
+		if durations := recentFinishedDurations(builds.Builds, int(c.opts.AverageWindow)); len(durations) > 0 {
+			avg, name := mean(durations), "Average"
+			if c.opts.AverageMethod == "median" {
+				avg, name = percentile(durations, 50), "Median"
+			}
+			msg := fmt.Sprintf("%s duration of recent %d builds is %s", name, len(durations), avg.Round(time.Second))
+			switch {
+			case c.opts.AverageCritical > 0 && avg > c.opts.AverageCritical.Duration():
+				alerts = append(alerts, checkers.Critical(msg))
+			case c.opts.AverageWarning > 0 && avg > c.opts.AverageWarning.Duration():
+				alerts = append(alerts, checkers.Warning(msg))
+			}
+		}
+	}
+	if len(alerts) == 0 {
+		return checkers.NewChecker(checkSt, "No build that takes too long time exists"), nil
+	}
+	return combine(alerts), numbers
+}
+
+// combine reports the worst status of the checkers with all of their messages,
+// where nil means nothing to report, and returns nil if no checker is given
+func combine(ckrs []*checkers.Checker) *checkers.Checker {
+	var worst *checkers.Checker
+	msgs := make([]string, 0, len(ckrs))
+	for _, ckr := range ckrs {
+		if ckr == nil {
+			continue
+		}
+		worst = worse(worst, ckr)
+		msgs = append(msgs, ckr.Message)
+	}
+	if worst == nil {
+		return nil
+	}
+	return checkers.NewChecker(worst.Status, strings.Join(msgs, ", "))
+}
+
+// withAlerts adds the messages of the alerts which are not OK to the checker,
+// whose own message is dropped when it is OK
+func withAlerts(ckr *checkers.Checker, alerts ...*checkers.Checker) *checkers.Checker {
+	ckrs := make([]*checkers.Checker, 0, len(alerts)+1)
+	if ckr.Status != checkers.OK {
+		ckrs = append(ckrs, ckr)
+	}
+	for _, a := range alerts {
+		if a != nil && a.Status != checkers.OK {
+			ckrs = append(ckrs, a)
+		}
+	}
+	if len(ckrs) == 0 {
+		return ckr
+	}
+	return combine(ckrs)
+}
@@ -0,0 +1,329 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+)
+
+func TestTimestampUnit(t *testing.T) {
+	started := testNow.Add(-10 * time.Minute)
+	tests := []struct {
+		unit      string
+		timestamp int64
+	}{
+		{"ms", started.UnixMilli()},
+		{"s", started.Unix()},
+		{"ns", started.UnixNano()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			srv := stubJenkins(t, map[string]string{
+				"/job/deploy/": fmt.Sprintf(`{"builds": [{"number": 3, "timestamp": %d, "duration": 0, "building": true}]}`, tt.timestamp),
+			})
+			ckr := testRun(t, srv.URL, "-j", "deploy", "-w", "300", "-c", "3600", "--timestamp-unit", tt.unit)
+			if ckr.Status != checkers.WARNING {
+				t.Errorf("status = %s, want WARNING: %s", ckr.Status, ckr.Message)
+			}
+			if !strings.Contains(ckr.Message, "10m0s > 5m0s") {
+				t.Errorf("message = %q, want the build running for 10m0s", ckr.Message)
+			}
+		})
+	}
+}
+
+// TestTimestampUnitPerClient keeps the unit of each client, built one after another as library callers may
+func TestTimestampUnitPerClient(t *testing.T) {
+	started := testNow.Add(-10 * time.Minute)
+	seconds := stubJenkins(t, map[string]string{
+		"/job/deploy/": fmt.Sprintf(`{"builds": [{"number": 3, "timestamp": %d, "duration": 0, "building": true}]}`, started.Unix()),
+		"/queue/":      fmt.Sprintf(`{"items": [{"id": 7, "inQueueSince": %d, "why": "Waiting for next available executor", "task": {"url": "http://jenkins/job/deploy/"}}]}`, started.Unix()),
+	})
+	millis := stubJenkins(t, map[string]string{
+		"/job/deploy/": buildsJSON(stubBuild{number: 3, ago: 10 * time.Minute}),
+	})
+	cacheFile := filepath.Join(t.TempDir(), "cache.json")
+	s := testClient(t, seconds.URL, "-j", "deploy", "-w", "300", "-c", "3600", "--timestamp-unit", "s", "--cache-file", cacheFile)
+	ms := testClient(t, millis.URL, "-j", "deploy", "-w", "300", "-c", "3600")
+
+	for name, c := range map[string]*Client{"s": s, "ms": ms} {
+		ckr, _ := c.run(context.Background())
+		if ckr.Status != checkers.WARNING || !strings.Contains(ckr.Message, "10m0s > 5m0s") {
+			t.Errorf("%s: %s %q, want the build running for 10m0s", name, ckr.Status, ckr.Message)
+		}
+	}
+	items, err := s.fetchQueue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || !items[0].InQueueSince.toTime().Equal(started) {
+		t.Errorf("queue items = %v, want the item queued at %s", items, started)
+	}
+	// The cache keeps timestamps in milliseconds whatever the unit is
+	bs, _, ok := s.cachedBuilds(s.newTarget("deploy", 5*time.Minute, time.Hour))
+	if !ok || len(bs.Builds) != 1 || !bs.Builds[0].startedAt().Equal(started) {
+		t.Errorf("cached builds = %v, want the build started at %s", bs.Builds, started)
+	}
+}
+
+// finishedBuilds returns finished builds with the durations from oldest to newest, listed newest first as Jenkins does
+func finishedBuilds(durations ...time.Duration) []stubBuild {
+	bs := make([]stubBuild, 0, len(durations))
+	for i := len(durations) - 1; i >= 0; i-- {
+		bs = append(bs, stubBuild{number: i + 1, ago: time.Duration(len(durations)-i) * time.Hour, duration: durations[i], result: "SUCCESS"})
+	}
+	return bs
+}
+
+func TestTrend(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		args      []string
+		want      checkers.Status
+	}{
+		{"increasing", []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 40 * time.Second, 50 * time.Second}, nil, checkers.WARNING},
+		{"flat once", []time.Duration{10 * time.Second, 20 * time.Second, 20 * time.Second, 40 * time.Second, 50 * time.Second}, nil, checkers.OK},
+		{"decreasing", []time.Duration{50 * time.Second, 40 * time.Second, 30 * time.Second, 20 * time.Second, 10 * time.Second}, nil, checkers.OK},
+		{"increasing in the window", []time.Duration{50 * time.Second, 10 * time.Second, 20 * time.Second, 30 * time.Second}, []string{"--trend-window", "3"}, checkers.WARNING},
+		{"slope over the seconds per build", []time.Duration{10 * time.Second, 5 * time.Second, 30 * time.Second, 40 * time.Second}, []string{"--trend-slope", "5"}, checkers.WARNING},
+		{"slope under the seconds per build", []time.Duration{10 * time.Second, 12 * time.Second, 14 * time.Second, 16 * time.Second}, []string{"--trend-slope", "5"}, checkers.OK},
+		{"single build", []time.Duration{10 * time.Second}, nil, checkers.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := stubJenkins(t, map[string]string{"/job/deploy/": buildsJSON(finishedBuilds(tt.durations...)...)})
+			ckr := testRun(t, srv.URL, append([]string{"-j", "deploy", "-w", "3600", "-c", "7200", "--trend"}, tt.args...)...)
+			if ckr.Status != tt.want {
+				t.Errorf("status = %s, want %s: %s", ckr.Status, tt.want, ckr.Message)
+			}
+			if tt.want == checkers.WARNING && !strings.Contains(ckr.Message, "are increasing") {
+				t.Errorf("message = %q, want the trend", ckr.Message)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want map[checkers.Status]int
+	}{
+		{"defaults", nil, map[checkers.Status]int{checkers.OK: 0, checkers.WARNING: 1, checkers.CRITICAL: 2, checkers.UNKNOWN: 3}},
+		{"custom", []string{"--ok-code", "10", "--warning-code", "11", "--critical-code", "12", "--unknown-code", "13"}, map[checkers.Status]int{checkers.OK: 10, checkers.WARNING: 11, checkers.CRITICAL: 12, checkers.UNKNOWN: 13}},
+		{"unknown as ok", []string{"--unknown-code", "0"}, map[checkers.Status]int{checkers.OK: 0, checkers.WARNING: 1, checkers.CRITICAL: 2, checkers.UNKNOWN: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions(t, "http://localhost:8080", append([]string{"-j", "deploy"}, tt.args...)...)
+			for st, want := range tt.want {
+				if got := opts.exitCode(st); got != want {
+					t.Errorf("exit code of %s = %d, want %d", st, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJobNameFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		args []string
+		want []string
+	}{
+		{"from the environment", "deploy", nil, []string{"deploy"}},
+		{"flag over the environment", "deploy", []string{"-j", "release"}, []string{"release"}},
+		{"folder", "team/deploy", nil, []string{"team/deploy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JENKINS_JOB_NAME", tt.env)
+			opts := testOptions(t, "http://localhost:8080", tt.args...)
+			if strings.Join(opts.JobNames, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("jobs = %v, want %v", opts.JobNames, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobNameRequired(t *testing.T) {
+	t.Setenv("JENKINS_JOB_NAME", "")
+	opts, err := NewOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseFlags(&opts, []string{"--url", "http://localhost:8080"}, flags.None); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.validate(); err == nil {
+		t.Error("no job was accepted")
+	}
+}
+
+func TestStrictSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		strict   bool
+		want     checkers.Status
+	}{
+		{"missing builds", `{"_class": "hudson.model.FreeStyleProject"}`, true, checkers.UNKNOWN},
+		{"null builds", `{"builds": null}`, true, checkers.UNKNOWN},
+		{"empty history", `{"builds": []}`, true, checkers.OK},
+		{"missing builds without the flag", `{"_class": "hudson.model.FreeStyleProject"}`, false, checkers.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := stubJenkins(t, map[string]string{"/job/deploy/": tt.response})
+			args := []string{"-j", "deploy"}
+			if tt.strict {
+				args = append(args, "--strict-schema")
+			}
+			ckr := testRun(t, srv.URL, args...)
+			if ckr.Status != tt.want {
+				t.Errorf("status = %s, want %s: %s", ckr.Status, tt.want, ckr.Message)
+			}
+			if tt.want == checkers.UNKNOWN && !strings.Contains(ckr.Message, "does not contain builds") {
+				t.Errorf("message = %q, want the missing key", ckr.Message)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	running := buildsJSON(
+		stubBuild{number: 3, ago: 4 * time.Minute},
+		stubBuild{number: 2, ago: 3 * time.Minute},
+		stubBuild{number: 1, ago: time.Hour, duration: 30 * time.Minute, result: "SUCCESS"},
+	)
+	tests := []struct {
+		name      string
+		aggregate string
+		want      checkers.Status
+	}{
+		{"over the total", "360", checkers.WARNING},
+		{"over the total as a duration", "5m", checkers.WARNING},
+		{"under the total", "8m", checkers.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := stubJenkins(t, map[string]string{"/job/deploy/": running})
+			// Each build is within the thresholds, the finished one is not counted
+			ckr := testRun(t, srv.URL, "-j", "deploy", "-w", "600", "-c", "3600", "--aggregate-seconds", tt.aggregate)
+			if ckr.Status != tt.want {
+				t.Errorf("status = %s, want %s: %s", ckr.Status, tt.want, ckr.Message)
+			}
+			if tt.want == checkers.WARNING && !strings.Contains(ckr.Message, "Running builds take 7m0s in total") {
+				t.Errorf("message = %q, want the total of 7m0s", ckr.Message)
+			}
+		})
+	}
+}
+
+func TestExpectRunning(t *testing.T) {
+	idle := []stubBuild{{number: 1, ago: time.Hour, duration: time.Minute, result: "SUCCESS"}}
+	busy := []stubBuild{{number: 2, ago: 10 * time.Second}, {number: 1, ago: time.Hour, duration: time.Minute, result: "SUCCESS"}}
+	tests := []struct {
+		name   string
+		builds []stubBuild
+		args   []string
+		want   checkers.Status
+	}{
+		{"none running", idle, []string{"--expect-running"}, checkers.CRITICAL},
+		{"none running as a warning", idle, []string{"--expect-running=warning"}, checkers.WARNING},
+		{"running", busy, []string{"--expect-running"}, checkers.OK},
+		{"no build at all", nil, []string{"--expect-running"}, checkers.CRITICAL},
+		{"without the flag", idle, nil, checkers.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := stubJenkins(t, map[string]string{"/job/deploy/": buildsJSON(tt.builds...)})
+			ckr := testRun(t, srv.URL, append([]string{"-j", "deploy"}, tt.args...)...)
+			if ckr.Status != tt.want {
+				t.Errorf("status = %s, want %s: %s", ckr.Status, tt.want, ckr.Message)
+			}
+			if tt.want != checkers.OK && ckr.Message != "No build is running" {
+				t.Errorf("message = %q, want that no build is running", ckr.Message)
+			}
+		})
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	tests := []struct {
+		msg  string
+		n    int
+		want string
+	}{
+		{"Build id = 3 takes too long time", 12, "Build id = …"},
+		{"Build id = 3", 12, "Build id = 3"},
+		{"Build id = 3", 0, "Build id = 3"},
+		{"ジョブ デプロイ が長すぎます", 8, "ジョブ デプロ…"},
+	}
+	for _, tt := range tests {
+		if got := truncateMessage(tt.msg, tt.n); got != tt.want {
+			t.Errorf("truncateMessage(%q, %d) = %q, want %q", tt.msg, tt.n, got, tt.want)
+		}
+	}
+}
+
+// TestMaxMessageLength truncates the message of many offending builds
+func TestMaxMessageLength(t *testing.T) {
+	bs := make([]stubBuild, 0)
+	for i := 1; i <= 20; i++ {
+		bs = append(bs, stubBuild{number: i, ago: 10 * time.Minute})
+	}
+	srv := stubJenkins(t, map[string]string{"/job/deploy/": buildsJSON(bs...)})
+	ckr := testRun(t, srv.URL, "-j", "deploy", "--max-message-length", "100")
+	if ckr.Status != checkers.CRITICAL {
+		t.Errorf("status = %s, want CRITICAL", ckr.Status)
+	}
+	if n := len([]rune(ckr.Message)); n != 100 || !strings.HasSuffix(ckr.Message, "…") {
+		t.Errorf("message of %d characters = %q, want 100 ending with an ellipsis", n, ckr.Message)
+	}
+}
+
+func TestOldestOnly(t *testing.T) {
+	running := buildsJSON(
+		stubBuild{number: 3, ago: 6 * time.Minute},
+		stubBuild{number: 2, ago: 20 * time.Minute},
+		stubBuild{number: 1, ago: time.Hour, duration: time.Hour, result: "SUCCESS"},
+	)
+	tests := []struct {
+		name     string
+		args     []string
+		want     checkers.Status
+		reported []string
+		ignored  []string
+	}{
+		{"every running build", nil, checkers.CRITICAL, []string{"Build id = 2", "Build id = 3"}, nil},
+		{"oldest only", []string{"--oldest-only"}, checkers.CRITICAL, []string{"Build id = 2"}, []string{"Build id = 3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := stubJenkins(t, map[string]string{"/job/deploy/": running})
+			ckr := testRun(t, srv.URL, append([]string{"-j", "deploy", "-w", "300", "-c", "900"}, tt.args...)...)
+			if ckr.Status != tt.want {
+				t.Errorf("status = %s, want %s: %s", ckr.Status, tt.want, ckr.Message)
+			}
+			for _, s := range tt.reported {
+				if !strings.Contains(ckr.Message, s) {
+					t.Errorf("message = %q, want %s reported", ckr.Message, s)
+				}
+			}
+			for _, s := range tt.ignored {
+				if strings.Contains(ckr.Message, s) {
+					t.Errorf("message = %q, want %s not reported", ckr.Message, s)
+				}
+			}
+		})
+	}
+}
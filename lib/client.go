@@ -0,0 +1,173 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+)
+
+// Client checks jobs of a Jenkins with the Options it is constructed from.
+// The HTTP client is built on the first check and reused by later ones.
+type Client struct {
+	opts Options
+
+	setupOnce sync.Once
+	setupErr  error
+	http      *http.Client
+	// customHTTP and transport are given by ClientOption instead of being built from the options
+	customHTTP *http.Client
+	transport  http.RoundTripper
+	// now is the clock elapsed times are measured with
+	now func() time.Time
+	// krb is logged in by setupNegotiate when `--negotiate` is given
+	krb *krbclient.Client
+	// completedJobs counts jobs checked without errors in the run,
+	// so that a 401 after them can be told apart from credentials that never worked.
+	completedJobs int64
+
+	// ignoreThresholds is set when Jenkins is quieting down with `--quiet-down=ignore-thresholds`,
+	// since builds legitimately wait and run long during maintenance.
+	ignoreThresholds bool
+	// lastStatus is the status reported last, used when checking repeatedly without `--state-file`
+	lastStatus string
+	// runMu serializes checks run by concurrent requests to `--serve`
+	runMu sync.Mutex
+	// latest is the snapshot taken last while polling with `--poll-interval`
+	latestMu sync.RWMutex
+	latest   *snapshot
+	// iapIDToken is the ID token for Identity-Aware Proxy renewed before iapExpiry
+	iapMu      sync.Mutex
+	iapIDToken string
+	iapExpiry  time.Time
+	// cacheMu serializes updates of `--cache-file` by concurrent checks of jobs
+	cacheMu sync.Mutex
+	// instances are the clients of other Jenkins in `--config`, by their settings
+	instancesMu sync.Mutex
+	instances   map[string]*Client
+	// resolvedCred are the credentials resolved by refreshCredentials for the current check
+	credMu       sync.RWMutex
+	resolvedCred *credentials
+	// outbound is the client for services other than Jenkins
+	outboundOnce sync.Once
+	outbound     *http.Client
+}
+
+// NewOptions returns Options filled with the defaults of the flags
+func NewOptions() (Options, error) {
+	var o Options
+	_, err := flags.NewParser(&o, flags.None).ParseArgs(nil)
+	return o, err
+}
+
+// ClientOption customizes a Client beyond Options
+type ClientOption func(*Client)
+
+// WithHTTPClient makes the Client send requests with hc as it is,
+// ignoring the options of TLS, proxies and timeouts of the connection.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) { c.customHTTP = hc }
+}
+
+// WithTransport replaces the transport built from the options of TLS and proxies,
+// e.g. to stub Jenkins in tests or to instrument requests.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(c *Client) { c.transport = rt }
+}
+
+// WithClock replaces the clock elapsed times are measured with, e.g. to pin the time in tests
+func WithClock(now func() time.Time) ClientOption {
+	return func(c *Client) { c.now = now }
+}
+
+// NewClient returns a Client checking with the options
+func NewClient(opts Options, options ...ClientOption) *Client {
+	c := &Client{opts: opts, http: http.DefaultClient, now: time.Now}
+	for _, o := range options {
+		o(c)
+	}
+	return c
+}
+
+// Thresholds of the elapsed time of builds.
+// Zero values fall back to the thresholds of the options, and NoThreshold disables one.
+type Thresholds struct {
+	Warning  time.Duration
+	Critical time.Duration
+}
+
+// Build is how a build of the job compares with the thresholds
+type Build struct {
+	Number int
+	URL    string
+	// Running is true until Jenkins reports the result of the build
+	Running bool
+	Result  string
+	Status  checkers.Status
+	// Elapsed is the elapsed time of the running build, or the duration of the finished build
+	Elapsed  time.Duration
+	Warning  time.Duration
+	Critical time.Duration
+}
+
+// Result of checking a job
+type Result struct {
+	Status  checkers.Status
+	Message string
+	Builds  []Build
+}
+
+// CheckJob checks the job given by the slash separated path in folders (e.g. team-a/service-x/main).
+// An error is returned when the builds cannot be fetched from Jenkins.
+func (c *Client) CheckJob(ctx context.Context, jobPath string, th Thresholds) (Result, error) {
+	if err := c.setupClient(); err != nil {
+		return Result{}, err
+	}
+	if err := c.refreshCredentials(ctx); err != nil {
+		return Result{}, err
+	}
+	warning, critical, err := c.thresholds()
+	if err != nil {
+		return Result{}, err
+	}
+	if th.Warning != 0 {
+		warning = th.Warning
+	}
+	if th.Critical != 0 {
+		critical = th.Critical
+	}
+	r := c.checkJob(ctx, c.newTarget(jobPath, warning, critical))
+	if r.err != nil {
+		return Result{}, r.err
+	}
+	ckr := c.mute(r.checker)
+	ret := Result{Status: ckr.Status, Message: ckr.Message, Builds: make([]Build, 0, len(r.evaluations))}
+	for _, e := range r.evaluations {
+		ret.Builds = append(ret.Builds, Build{
+			Number:   e.Number,
+			URL:      e.URL,
+			Running:  e.Running,
+			Result:   e.Result,
+			Status:   parseStatus(e.Status),
+			Elapsed:  fromSeconds(e.ElapsedSeconds),
+			Warning:  fromThresholdSeconds(e.WarningSeconds),
+			Critical: fromThresholdSeconds(e.CriticalSeconds),
+		})
+	}
+	return ret, nil
+}
+
+func fromSeconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func fromThresholdSeconds(s *float64) time.Duration {
+	if s == nil {
+		return NoThreshold
+	}
+	return fromSeconds(*s)
+}
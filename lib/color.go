@@ -0,0 +1,65 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+/*
+The color of a job summarizes the result of the last build, with the suffix _anime while a build is running.
+
+% curl -s "http://localhost:8080/job/deploy/api/json?tree=color"
+{"_class":"hudson.model.FreeStyleProject","color":"red_anime"}
+*/
+
+// defaultColorStatuses maps colors of jobs to statuses unless overridden by `--color-status`
+var defaultColorStatuses = map[string]string{
+	"blue":     "ok",
+	"yellow":   "warning",
+	"red":      "critical",
+	"aborted":  "warning",
+	"notbuilt": "ok",
+	"grey":     "ok",
+	"disabled": "ok",
+}
+
+const buildingSuffix = "_anime"
+
+// colorStatus returns the status of the color, without the suffix of a running build
+func (c *Client) colorStatus(color string) checkers.Status {
+	color = strings.TrimSuffix(color, buildingSuffix)
+	for _, cs := range c.opts.ColorStatuses {
+		if k, v, _ := splitParam(cs); strings.EqualFold(k, color) {
+			return parseStatus(v)
+		}
+	}
+	if color == "disabled" {
+		return parseStatus(c.opts.DisabledStatus)
+	}
+	if s, ok := defaultColorStatuses[color]; ok {
+		return parseStatus(s)
+	}
+	return checkers.UNKNOWN
+}
+
+// checkColor checks the job by its color alone with `--check-color`, skipping the builds
+func (c *Client) checkColor(ctx context.Context, t target) jobResult {
+	var j struct {
+		Color string `json:"color"`
+	}
+	if err := c.fetchJobJSON(ctx, t, "/api/json?tree=color", &j); err != nil {
+		return jobResult{job: t.job, checker: c.fetchErrorChecker(err), err: err}
+	}
+	if j.Color == "" {
+		// Folders and multibranch pipelines have no color
+		return jobResult{job: t.job, checker: checkers.Unknown("The job has no color")}
+	}
+	msg := fmt.Sprintf("The job is %s", strings.TrimSuffix(j.Color, buildingSuffix))
+	if strings.HasSuffix(j.Color, buildingSuffix) {
+		msg += " (building)"
+	}
+	return jobResult{job: t.job, checker: checkers.NewChecker(c.colorStatus(j.Color), msg+" "+c.jobURL(t.job, "/"))}
+}
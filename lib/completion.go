@@ -0,0 +1,129 @@
+package checkjenkinsbuildtime
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+)
+
+const commandName = "check-jenkins-build-time"
+
+// completionOption is a flag as shell completions see it
+type completionOption struct {
+	long        string
+	short       rune
+	description string
+	choices     []string
+	// argument is false for boolean flags
+	argument bool
+}
+
+// completionOptions lists the flags which are not hidden in the order of Options
+func completionOptions() []completionOption {
+	var opts Options
+	parser := flags.NewParser(&opts, flags.None)
+	ret := make([]completionOption, 0)
+	var walk func(g *flags.Group)
+	walk = func(g *flags.Group) {
+		for _, o := range g.Options() {
+			if o.Hidden || o.LongName == "" {
+				continue
+			}
+			t := reflect.TypeOf(o.Value())
+			if t.Kind() == reflect.Slice {
+				t = t.Elem()
+			}
+			ret = append(ret, completionOption{o.LongName, o.ShortName, o.Description, o.Choices, t.Kind() != reflect.Bool})
+		}
+		for _, sub := range g.Groups() {
+			walk(sub)
+		}
+	}
+	walk(parser.Command.Group)
+	return ret
+}
+
+// writeCompletion writes the completion script of the shell for `--completion`
+func writeCompletion(w io.Writer, shell string) error {
+	opts := completionOptions()
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, opts)
+	case "zsh":
+		writeZshCompletion(w, opts)
+	case "fish":
+		writeFishCompletion(w, opts)
+	default:
+		return fmt.Errorf("unsupported shell for completion: %s", shell)
+	}
+	return nil
+}
+
+func writeBashCompletion(w io.Writer, opts []completionOption) {
+	fn := "_" + strings.Replace(commandName, "-", "_", -1)
+	words := make([]string, 0, len(opts))
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+	fmt.Fprintln(w, `	case "$prev" in`)
+	for _, o := range opts {
+		words = append(words, "--"+o.long)
+		if !o.argument {
+			continue
+		}
+		names := "--" + o.long
+		if o.short != 0 {
+			names += fmt.Sprintf("|-%c", o.short)
+		}
+		if len(o.choices) > 0 {
+			fmt.Fprintf(w, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", names, strings.Join(o.choices, " "))
+		} else {
+			fmt.Fprintf(w, "\t%s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", names)
+		}
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintf(w, "\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(words, " "))
+	fmt.Fprintln(w, "}")
+	fmt.Fprintf(w, "complete -F %s %s\n", fn, commandName)
+}
+
+var zshEscaper = strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`, `:`, `\:`)
+
+func writeZshCompletion(w io.Writer, opts []completionOption) {
+	fmt.Fprintf(w, "#compdef %s\n\n", commandName)
+	fmt.Fprintln(w, "_arguments \\")
+	for _, o := range opts {
+		spec := fmt.Sprintf("[%s]", zshEscaper.Replace(o.description))
+		switch {
+		case len(o.choices) > 0:
+			spec += fmt.Sprintf(":%s:(%s)", o.long, strings.Join(o.choices, " "))
+		case o.argument:
+			spec += fmt.Sprintf(":%s:_files", o.long)
+		}
+		names := "--" + o.long
+		if o.short != 0 {
+			names = fmt.Sprintf("{-%c,--%s}", o.short, o.long)
+		}
+		fmt.Fprintf(w, "\t%s'%s' \\\n", names, spec)
+	}
+	fmt.Fprintln(w)
+}
+
+func writeFishCompletion(w io.Writer, opts []completionOption) {
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	for _, o := range opts {
+		line := fmt.Sprintf("complete -c %s -l %s", commandName, o.long)
+		if o.short != 0 {
+			line += fmt.Sprintf(" -s %c", o.short)
+		}
+		if o.argument {
+			line += " -r"
+		}
+		if len(o.choices) > 0 {
+			line += fmt.Sprintf(" -f -a '%s'", strings.Join(o.choices, " "))
+		}
+		fmt.Fprintf(w, "%s -d '%s'\n", line, quote.Replace(o.description))
+	}
+}
@@ -0,0 +1,123 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+// Both /computer/api/json and /label/<label>/api/json report executors in the same fields
+type executors struct {
+	BusyExecutors  int `json:"busyExecutors"`
+	TotalExecutors int `json:"totalExecutors"`
+}
+
+func (c *Client) executorsURL(label string) string {
+	if label != "" {
+		return fmt.Sprintf("%s/label/%s/api/json?tree=busyExecutors,totalExecutors", c.baseURL(), url.PathEscape(label))
+	}
+	return c.baseURL() + "/computer/api/json?tree=busyExecutors,totalExecutors"
+}
+
+func (c *Client) fetchExecutors(ctx context.Context, label string) (executors, error) {
+	var e executors
+	err := c.fetchJSON(ctx, c.executorsURL(label), c.defaultCredentials(), &e)
+	return e, err
+}
+
+func (c *Client) checkExecutors(ctx context.Context) *checkers.Checker {
+	e, err := c.fetchExecutors(ctx, c.opts.Label)
+	if err != nil {
+		return c.fetchErrorChecker(err)
+	}
+	scope := "the instance"
+	if c.opts.Label != "" {
+		scope = "label " + c.opts.Label
+	}
+	if e.TotalExecutors == 0 {
+		return checkers.Critical(fmt.Sprintf("No executor exists for %s", scope))
+	}
+	usage := float64(e.BusyExecutors) / float64(e.TotalExecutors) * 100
+	msg := fmt.Sprintf("%d of %d executors are busy (%.1f%%) for %s", e.BusyExecutors, e.TotalExecutors, usage, scope)
+	switch {
+	case usage > c.opts.ExecutorsCritical:
+		return checkers.Critical(msg)
+	case usage > c.opts.ExecutorsWarning:
+		return checkers.Warning(msg)
+	}
+	return checkers.Ok(msg)
+}
+
+type computer struct {
+	DisplayName        string `json:"displayName"`
+	Offline            bool   `json:"offline"`
+	TemporarilyOffline bool   `json:"temporarilyOffline"`
+	OfflineCauseReason string `json:"offlineCauseReason"`
+	AssignedLabels     []struct {
+		Name string `json:"name"`
+	} `json:"assignedLabels"`
+}
+
+func (c computer) hasLabel(label string) bool {
+	for _, l := range c.AssignedLabels {
+		if l.Name == label {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) computersURL() string {
+	return c.baseURL() + "/computer/api/json?tree=computer[displayName,offline,temporarilyOffline,offlineCauseReason,assignedLabels[name]]"
+}
+
+func (c *Client) fetchComputers(ctx context.Context) ([]computer, error) {
+	var cs struct {
+		Computer []computer `json:"computer"`
+	}
+	err := c.fetchJSON(ctx, c.computersURL(), c.defaultCredentials(), &cs)
+	return cs.Computer, err
+}
+
+// checkNodes goes critical on offline agents, and warning on agents marked temporarily offline by someone
+func (c *Client) checkNodes(ctx context.Context) *checkers.Checker {
+	cs, err := c.fetchComputers(ctx)
+	if err != nil {
+		return c.fetchErrorChecker(err)
+	}
+	st := checkers.OK
+	msgs := make([]string, 0)
+	checked := 0
+	for _, n := range cs {
+		if ok, _ := path.Match(c.opts.NodePattern, n.DisplayName); !ok {
+			continue
+		}
+		if c.opts.Label != "" && !n.hasLabel(c.opts.Label) {
+			continue
+		}
+		checked++
+		if !n.Offline {
+			continue
+		}
+		nodeSt := checkers.CRITICAL
+		if n.TemporarilyOffline {
+			nodeSt = checkers.WARNING
+		}
+		if severity(nodeSt) > severity(st) {
+			st = nodeSt
+		}
+		msg := fmt.Sprintf("%s is offline", n.DisplayName)
+		if n.OfflineCauseReason != "" {
+			msg += fmt.Sprintf(" (%s)", n.OfflineCauseReason)
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return checkers.Ok(fmt.Sprintf("All %d agents are online", checked))
+	}
+	return checkers.NewChecker(st, strings.Join(msgs, ", "))
+}
@@ -0,0 +1,222 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+/*
+Jobs can be listed with their own settings in a TOML file given by `--config`.
+Settings omitted there fall back to the flags. Thresholds are seconds or durations as the flags, e.g. 600 or "10m".
+
+[[job]]
+name = "deploy"
+warning_second = 600
+critical_second = 1800
+
+[[job]]
+name = "team-a/nightly"
+critical_second = "4h"
+max_job_number = 3
+user = "monitor"
+api_token = "..."
+
+[[job]]
+name = "deploy"
+params = ["ENV=production"]
+critical_second = 900
+
+Other Jenkins instances can be checked in the same run by `[[jenkins]]`, each with its own URL, credentials and jobs.
+The other settings, e.g. TLS, follow the flags. Without user and api_token, the instance gets the credentials of
+--credential-command, --vault-path or --aws-secret-id if given, and is accessed anonymously otherwise.
+Their jobs are reported as `<name>:<job>`.
+
+[[jenkins]]
+name = "team-b"
+url = "https://jenkins-b.example.com"
+user = "monitor"
+api_token = "..."
+
+[[jenkins.job]]
+name = "deploy"
+critical_second = 900
+
+Thresholds can be overridden in weekly windows of `--timezone`, for all jobs by `[[schedule]]`
+or for the job by `[[job.schedule]]`. The first window containing the current time is used.
+
+[[schedule]]
+window = "Mon-Fri 09:00-18:00"
+critical_second = 1800
+
+[[job]]
+name = "nightly-batch"
+
+[[job.schedule]]
+window = "22:00-06:00"
+critical_second = 14400
+*/
+
+type config struct {
+	Jobs      []jobConfig      `toml:"job"`
+	Schedules []scheduleConfig `toml:"schedule"`
+	Instances []instanceConfig `toml:"jenkins"`
+}
+
+type instanceConfig struct {
+	Name     string      `toml:"name"`
+	URL      string      `toml:"url"`
+	User     string      `toml:"user"`
+	APIToken string      `toml:"api_token"`
+	Jobs     []jobConfig `toml:"job"`
+}
+
+type scheduleConfig struct {
+	Window         string    `toml:"window"`
+	WarningSecond  *duration `toml:"warning_second"`
+	CriticalSecond *duration `toml:"critical_second"`
+}
+
+// scheduled returns the thresholds overridden by the active schedule
+func (c *Client) scheduled(schedules []scheduleConfig, warning, critical time.Duration) (time.Duration, time.Duration, error) {
+	specs := make([]string, 0, len(schedules))
+	for _, sc := range schedules {
+		specs = append(specs, sc.Window)
+	}
+	i, err := c.activeWindow(specs, c.now())
+	if err != nil || i < 0 {
+		return warning, critical, err
+	}
+	sc := schedules[i]
+	warning, critical, err = c.overrideThresholds(warning, critical, sc.WarningSecond, sc.CriticalSecond)
+	if err != nil {
+		return 0, 0, fmt.Errorf("schedule %q: %s", sc.Window, err)
+	}
+	return warning, critical, nil
+}
+
+type jobConfig struct {
+	Name           string           `toml:"name"`
+	WarningSecond  *duration        `toml:"warning_second"`
+	CriticalSecond *duration        `toml:"critical_second"`
+	MaxJobNumber   *int64           `toml:"max_job_number"`
+	User           string           `toml:"user"`
+	APIToken       string           `toml:"api_token"`
+	Params         []string         `toml:"params"`
+	ExcludeParams  []string         `toml:"exclude_params"`
+	Schedules      []scheduleConfig `toml:"schedule"`
+}
+
+func loadConfig(path string) (*config, error) {
+	var conf config
+	if _, err := toml.DecodeFile(path, &conf); err != nil {
+		return nil, err
+	}
+	for _, inst := range conf.Instances {
+		if inst.Name == "" || inst.URL == "" {
+			return nil, fmt.Errorf("every jenkins in %s needs name and url", path)
+		}
+	}
+	return &conf, nil
+}
+
+// targets returns the targets of the jobs in the config with the thresholds of their schedules
+func (c *Client) targets(jobs []jobConfig, warning, critical time.Duration) ([]target, error) {
+	targets := make([]target, 0, len(jobs))
+	for _, j := range jobs {
+		t := j.apply(c.newTarget(j.Name, warning, critical))
+		var err error
+		if t.warning, t.critical, err = c.overrideThresholds(t.warning, t.critical, j.WarningSecond, j.CriticalSecond); err != nil {
+			return nil, fmt.Errorf("job %s: %s", j.Name, err)
+		}
+		if t.warning, t.critical, err = c.scheduled(j.Schedules, t.warning, t.critical); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// instance is another Jenkins of the config, whose jobs are fetched by its own client
+type instance struct {
+	name   string
+	client *Client
+}
+
+// instanceClient returns the client of the other Jenkins, built once and reused by later checks
+// so that connections are kept alive with `--watch` and `--serve`
+func (c *Client) instanceClient(ctx context.Context, inst instanceConfig) (*Client, error) {
+	key := fmt.Sprintf("%s\x00%s\x00%s\x00%s", inst.Name, inst.URL, inst.User, inst.APIToken)
+	c.instancesMu.Lock()
+	defer c.instancesMu.Unlock()
+	if ic, ok := c.instances[key]; ok {
+		return ic, ic.refreshCredentials(ctx)
+	}
+	ic := c.newInstanceClient(inst)
+	if err := ic.setupClient(); err != nil {
+		return nil, fmt.Errorf("failed to set up HTTP client for %s: %s", inst.Name, err)
+	}
+	if err := ic.refreshCredentials(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get the credentials for %s: %s", inst.Name, err)
+	}
+	if c.instances == nil {
+		c.instances = make(map[string]*Client)
+	}
+	c.instances[key] = ic
+	return ic, nil
+}
+
+// newInstanceClient returns the client of the other Jenkins, which is neither set up nor given the credentials yet
+func (c *Client) newInstanceClient(inst instanceConfig) *Client {
+	opts := c.opts
+	opts.URL, opts.Prefix = inst.URL, ""
+	opts.User, opts.APIToken = inst.User, inst.APIToken
+	if inst.User != "" || inst.APIToken != "" {
+		// The credentials of the instance are not overwritten by those for the Jenkins of the flags
+		opts.CredentialCommand, opts.VaultPath, opts.AWSSecretID = "", "", ""
+	}
+	ic := NewClient(opts)
+	ic.customHTTP, ic.transport, ic.now = c.customHTTP, c.transport, c.now
+	return ic
+}
+
+// instanceTargets returns the targets of the jobs of the other Jenkins
+func (c *Client) instanceTargets(ctx context.Context, inst instanceConfig, warning, critical time.Duration) ([]target, error) {
+	ic, err := c.instanceClient(ctx, inst)
+	if err != nil {
+		return nil, err
+	}
+	return ic.instanceJobTargets(inst, warning, critical)
+}
+
+// instanceJobTargets returns the targets of the jobs of inst, called on the client of the instance
+func (c *Client) instanceJobTargets(inst instanceConfig, warning, critical time.Duration) ([]target, error) {
+	targets, err := c.targets(inst.Jobs, warning, critical)
+	if err != nil {
+		return nil, err
+	}
+	for i := range targets {
+		targets[i].instance = &instance{inst.Name, c}
+	}
+	return targets, nil
+}
+
+// apply overrides the settings of the target with those given in the config, except the thresholds
+// which are resolved by overrideThresholds
+func (c jobConfig) apply(t target) target {
+	if c.MaxJobNumber != nil {
+		t.maxJobNumber = *c.MaxJobNumber
+	}
+	if c.User != "" || c.APIToken != "" {
+		t.cred = credentials{c.User, c.APIToken}
+	}
+	if c.Params != nil {
+		t.params = c.Params
+	}
+	if c.ExcludeParams != nil {
+		t.excludeParams = c.ExcludeParams
+	}
+	return t
+}
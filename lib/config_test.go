@@ -0,0 +1,54 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConfigThresholds resolves the thresholds of the config and its schedules as those of the flags
+func TestConfigThresholds(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		args         []string
+		wantErr      string
+		wantWarning  time.Duration
+		wantCritical time.Duration
+	}{
+		{"job", "[[job]]\nname = \"deploy\"\nwarning_second = 120\ncritical_second = \"10m\"\n", []string{"-w", "60", "-c", "300"}, "", 2 * time.Minute, 10 * time.Minute},
+		{"negative in job", "[[job]]\nname = \"deploy\"\ncritical_second = -1\n", []string{"-w", "60", "-c", "300"}, "must not be negative", 0, 0},
+		{"negative in schedule", "[[schedule]]\nwindow = \"Wed 09:00-18:00\"\nwarning_second = \"-5m\"\n\n[[job]]\nname = \"deploy\"\n", []string{"-w", "60", "-c", "300"}, "must not be negative", 0, 0},
+		{"job under --no-warning", "[[job]]\nname = \"deploy\"\nwarning_second = 120\n", []string{"--no-warning", "-c", "300"}, "", NoThreshold, 5 * time.Minute},
+		{"schedule under --no-critical", "[[schedule]]\nwindow = \"Wed 09:00-18:00\"\ncritical_second = 900\n\n[[job]]\nname = \"deploy\"\n", []string{"-w", "60", "--no-critical"}, "", time.Minute, NoThreshold},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := filepath.Join(t.TempDir(), "jobs.toml")
+			if err := ioutil.WriteFile(conf, []byte(tt.body), 0644); err != nil {
+				t.Fatal(err)
+			}
+			c := testClient(t, "http://localhost:8080", append([]string{"--config", conf, "--timezone", "UTC"}, tt.args...)...)
+			warning, critical, err := c.thresholds()
+			if err != nil {
+				t.Fatal(err)
+			}
+			targets, err := c.targetJobs(context.Background(), warning, critical)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(targets) != 1 || targets[0].warning != tt.wantWarning || targets[0].critical != tt.wantCritical {
+				t.Errorf("targets = %+v, want warning %s and critical %s", targets, formatThreshold(tt.wantWarning), formatThreshold(tt.wantCritical))
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package checkjenkinsbuildtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+The command given by `--credential-command` prints the credentials on stdout, either as `user:token` in a line
+or as `key=value` lines like git credential helpers, where the keys are username (or user) and password (or token).
+
+% pass show ci/jenkins
+monitor:11d3a7b1f2...
+
+% vault kv get -format=json secret/jenkins | jq -r '"username=\(.data.data.user)\npassword=\(.data.data.token)"'
+username=monitor
+password=11d3a7b1f2...
+
+The user of the command is used only when the output has it, so that the user can also be given by `--user`.
+*/
+
+// shellCommand runs the command line in the shell of the platform, since helpers are given with their arguments.
+// args are appended to the arguments of the line, quoted as "$@" of sh.
+func shellCommand(ctx context.Context, line string, args ...string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", append([]string{"/C", line}, args...)...)
+	}
+	if len(args) > 0 {
+		return exec.CommandContext(ctx, "sh", append([]string{"-c", line + ` "$@"`, "sh"}, args...)...)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
+
+// parseCredentials reads the output of the credential command
+func parseCredentials(out string) (user, token string, err error) {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) == 1 && !strings.Contains(lines[0], "=") {
+		if i := strings.Index(lines[0], ":"); i >= 0 {
+			return lines[0][:i], strings.TrimSpace(lines[0][i+1:]), nil
+		}
+		return "", strings.TrimSpace(lines[0]), nil
+	}
+	for _, l := range lines {
+		i := strings.Index(l, "=")
+		if i < 0 {
+			continue
+		}
+		v := strings.TrimSpace(l[i+1:])
+		switch strings.TrimSpace(l[:i]) {
+		case "username", "user":
+			user = v
+		case "password", "token":
+			token = v
+		}
+	}
+	if token == "" {
+		return "", "", errors.New("no password or token is found in the output")
+	}
+	return user, token, nil
+}
+
+// commandCredentials runs `--credential-command` for the credentials
+func (c *Client) commandCredentials(ctx context.Context) (user, token string, err error) {
+	var stdout, stderr bytes.Buffer
+	cmd := shellCommand(ctx, c.opts.CredentialCommand)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", "", fmt.Errorf("%s: %s", err, msg)
+		}
+		return "", "", err
+	}
+	return parseCredentials(stdout.String())
+}
+
+// hasCredentialSource reports whether the credentials are resolved on every check rather than given by flags
+func (o *Options) hasCredentialSource() bool {
+	return o.CredentialCommand != "" || o.VaultPath != "" || o.AWSSecretID != ""
+}
+
+// refreshCredentials resolves the credentials from their sources at the start of every check,
+// so that rotated tokens are picked up while checking repeatedly with `--watch` and `--serve`.
+// They override the credentials given by flags.
+func (c *Client) refreshCredentials(ctx context.Context) error {
+	// A run starts with the credentials, so the jobs accepting them are counted anew
+	atomic.StoreInt64(&c.completedJobs, 0)
+	if !c.opts.hasCredentialSource() {
+		return nil
+	}
+	cred := credentials{c.opts.User, c.opts.APIToken}
+	if c.opts.CredentialCommand != "" {
+		user, token, err := c.commandCredentials(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to run the credential command: %s", err)
+		}
+		if user != "" {
+			cred.user = user
+		}
+		cred.apiToken = token
+	}
+	if c.opts.VaultPath != "" || c.opts.AWSSecretID != "" {
+		user, token, err := c.secretCredentials(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read the secret: %s", err)
+		}
+		if user != "" {
+			cred.user = user
+		}
+		cred.apiToken = token
+	}
+	c.credMu.Lock()
+	c.resolvedCred = &cred
+	c.credMu.Unlock()
+	return nil
+}
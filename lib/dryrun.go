@@ -0,0 +1,102 @@
+package checkjenkinsbuildtime
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/mackerelio/checkers"
+)
+
+// dryRun prints the API URLs and the thresholds the check would use without contacting Jenkins.
+// Jobs found by `--job-regex`, `--view` and `--multibranch` are only known to Jenkins,
+// so the URLs listing them are printed instead.
+func (c *Client) dryRun(w io.Writer) *checkers.Checker {
+	switch {
+	case c.opts.CheckExecutors:
+		fmt.Fprintf(w, "GET %s\n", c.executorsURL(c.opts.Label))
+	case c.opts.CheckNodes:
+		fmt.Fprintf(w, "GET %s\n", c.computersURL())
+	case c.opts.CheckHealth:
+		fmt.Fprintf(w, "GET %s\n", c.healthURL())
+	}
+	if c.opts.isInstanceCheck() {
+		return checkers.Ok("Dry run, Jenkins was not contacted")
+	}
+	warning, critical, err := c.thresholds()
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Invalid thresholds: %s", err))
+	}
+	var conf *config
+	if c.opts.Config != "" {
+		if conf, err = loadConfig(c.opts.Config); err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		if warning, critical, err = c.scheduled(conf.Schedules, warning, critical); err != nil {
+			return checkers.Unknown(err.Error())
+		}
+	}
+	if c.opts.QuietDown != "off" {
+		fmt.Fprintf(w, "GET %s\n", c.quietingDownURL())
+	}
+	if c.opts.JobRegex != "" {
+		fmt.Fprintf(w, "jobs matching %q: warning %s, critical %s\n", c.opts.JobRegex, warning, critical)
+		fmt.Fprintf(w, "  GET %s/api/json?tree=jobs[name]\n", c.baseURL())
+	}
+	if c.opts.View != "" {
+		fmt.Fprintf(w, "jobs in the view %s: warning %s, critical %s\n", c.opts.View, warning, critical)
+		fmt.Fprintf(w, "  GET %s/view/%s/api/json?tree=jobs[name]\n", c.baseURL(), url.PathEscape(c.opts.View))
+	}
+	names := c.opts.JobNames
+	if c.opts.JobsFile != "" {
+		listed, err := readJobsFile(c.opts.JobsFile)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		names = append(append([]string{}, names...), listed...)
+	}
+	targets := make([]target, 0, len(names))
+	for _, n := range names {
+		targets = append(targets, c.newTarget(n, warning, critical))
+	}
+	if conf != nil {
+		confTargets, err := c.targets(conf.Jobs, warning, critical)
+		if err != nil {
+			return checkers.Unknown(err.Error())
+		}
+		targets = append(targets, confTargets...)
+		for _, inst := range conf.Instances {
+			// The client of the instance is not set up, which would run the credential command and read the secrets
+			instTargets, err := c.newInstanceClient(inst).instanceJobTargets(inst, warning, critical)
+			if err != nil {
+				return checkers.Unknown(err.Error())
+			}
+			targets = append(targets, instTargets...)
+		}
+	}
+	for _, t := range targets {
+		tc := t.client(c)
+		if tc.opts.Multibranch {
+			fmt.Fprintf(w, "branches of %s: warning %s, critical %s, credentials %s\n", t.label(), formatThreshold(t.warning), formatThreshold(t.critical), tc.credentialsState(t))
+			fmt.Fprintf(w, "  GET %s\n", tc.jobURL(t.job, "/api/json?tree=jobs[name]"))
+			continue
+		}
+		u := tc.jobURL(t.job, tc.buildsPath(t))
+		if tc.opts.API == "blueocean" && tc.opts.BuildNumber == 0 && !tc.opts.LastBuildOnly {
+			u = tc.blueRunsURL(t)
+		}
+		fmt.Fprintf(w, "%s: warning %s, critical %s, credentials %s\n", t.label(), formatThreshold(t.warning), formatThreshold(t.critical), tc.credentialsState(t))
+		fmt.Fprintf(w, "  GET %s\n", u)
+	}
+	return checkers.Ok("Dry run, Jenkins was not contacted")
+}
+
+// credentialsState tells whether credentials are configured for the target without resolving them
+func (c *Client) credentialsState(t target) string {
+	o := c.opts
+	if t.cred.user != "" || t.cred.apiToken != "" || o.User != "" || o.APIToken != "" || o.BearerToken != "" ||
+		o.hasCredentialSource() || o.Netrc || o.NetrcFile != "" || o.Negotiate || o.IAPAudience != "" {
+		return "configured"
+	}
+	return "not configured"
+}
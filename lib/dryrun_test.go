@@ -0,0 +1,77 @@
+package checkjenkinsbuildtime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+)
+
+// TestDryRunWithoutSideEffects lists the jobs of the instances without running the credential command
+func TestDryRunWithoutSideEffects(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential command is for sh")
+	}
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	conf := filepath.Join(dir, "jobs.toml")
+	body := `
+[[job]]
+name = "deploy"
+
+[[jenkins]]
+name = "team-b"
+url = "https://jenkins-b.example.com"
+
+[[jenkins.job]]
+name = "release"
+critical_second = 900
+
+[[jenkins]]
+name = "team-c"
+url = "https://jenkins-c.example.com"
+user = "monitor"
+api_token = "secret-token"
+
+[[jenkins.job]]
+name = "nightly"
+`
+	if err := ioutil.WriteFile(conf, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := testClient(t, "http://localhost:8080", "--config", conf, "--credential-command", "touch "+marker+" && echo monitor:token", "--dry-run")
+
+	var out bytes.Buffer
+	if ckr := c.dryRun(&out); ckr.Status != checkers.OK {
+		t.Fatalf("status = %s, want OK: %s", ckr.Status, ckr.Message)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("the credential command was run by the dry run")
+	}
+	for _, want := range []string{
+		"deploy: warning 1m0s, critical 5m0s, credentials configured\n",
+		"team-b:release: warning 1m0s, critical 15m0s, credentials configured\n",
+		"  GET https://jenkins-b.example.com/job/release/api/json?",
+		"team-c:nightly: warning 1m0s, critical 5m0s, credentials configured\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "secret-token") {
+		t.Errorf("output shows the API token:\n%s", out.String())
+	}
+}
+
+func TestDryRunCredentialsNotConfigured(t *testing.T) {
+	var out bytes.Buffer
+	testClient(t, "http://localhost:8080", "-j", "deploy", "--dry-run").dryRun(&out)
+	if want := "deploy: warning 1m0s, critical 5m0s, credentials not configured\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("output does not contain %q:\n%s", want, out.String())
+	}
+}
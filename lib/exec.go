@@ -0,0 +1,25 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/mackerelio/checkers"
+)
+
+// execHook starts the command line given by `--exec` in the shell as `--credential-command` is,
+// with the status and the message as arguments, also exported as CHECK_STATUS and CHECK_MESSAGE.
+// It does not wait for the command so that the checker exits in time, and its failure never alters the status.
+func execHook(command string, ckr *checkers.Checker) {
+	cmd := shellCommand(context.Background(), command, ckr.Status.String(), ckr.Message)
+	cmd.Env = append(os.Environ(),
+		"CHECK_STATUS="+ckr.Status.String(),
+		"CHECK_MESSAGE="+ckr.Message,
+	)
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to exec %s: %s", command, err)
+		return
+	}
+	cmd.Process.Release()
+}
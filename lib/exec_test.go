@@ -0,0 +1,44 @@
+package checkjenkinsbuildtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+// TestExecHook runs a stub script with an argument of its own, capturing the values passed after it
+func TestExecHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub script is for sh")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	script := filepath.Join(dir, "hook.sh")
+	body := "#!/bin/sh\nprintf '%s|%s|%s|%s|%s' \"$1\" \"$2\" \"$3\" \"$CHECK_STATUS\" \"$CHECK_MESSAGE\" > " + out + ".tmp && mv " + out + ".tmp " + out + "\n"
+	if err := ioutil.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	execHook(script+" --page", checkers.Critical(`Build id = 3 takes too long time ("deploy")`))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, err := ioutil.ReadFile(out)
+		if err == nil {
+			want := `--page|CRITICAL|Build id = 3 takes too long time ("deploy")|CRITICAL|Build id = 3 takes too long time ("deploy")`
+			if string(b) != want {
+				t.Errorf("hook got %q, want %q", b, want)
+			}
+			return
+		}
+		if !os.IsNotExist(err) || time.Now().After(deadline) {
+			t.Fatalf("the hook did not run: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,203 @@
+package checkjenkinsbuildtime
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+Causes and parameters of a build are found in its actions, as well as the time in the queue recorded by the Metrics plugin.
+
+% curl -s --globoff "http://localhost:8080/job/deploy/57/api/json?tree=actions[causes[_class],parameters[name,value],queuingDurationMillis]" | jq .
+{
+  "actions": [
+    {
+      "queuingDurationMillis": 95012
+    },
+    {
+      "parameters": [
+        {
+          "name": "ENV",
+          "value": "production"
+        }
+      ]
+    },
+    {
+      "causes": [
+        {
+          "_class": "hudson.triggers.TimerTrigger$TimerTriggerCause"
+        }
+      ]
+    },
+    {}
+  ]
+}
+*/
+
+type buildAction struct {
+	Causes []struct {
+		Class string `json:"_class"`
+	} `json:"causes"`
+	// Value may be a string, a boolean or a number depending on the parameter type
+	Parameters []struct {
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	} `json:"parameters"`
+	QueuingDurationMillis int64 `json:"queuingDurationMillis"`
+}
+
+// queueTime is how long the build waited in the queue, zero if the Metrics plugin is absent
+func (b build) queueTime() time.Duration {
+	var d int64
+	for _, a := range b.Actions {
+		d += a.QueuingDurationMillis
+	}
+	return time.Duration(d) * time.Millisecond
+}
+
+// causeClasses maps `--only-cause` and `--ignore-cause` to the cause classes of Jenkins and popular plugins
+var causeClasses = map[string][]string{
+	"timer":    {"hudson.triggers.TimerTrigger$TimerTriggerCause", "org.jenkinsci.plugins.parameterizedscheduler.ParameterizedTimerTriggerCause"},
+	"scm":      {"hudson.triggers.SCMTrigger$SCMTriggerCause", "com.cloudbees.jenkins.GitHubPushCause", "jenkins.branch.BranchEventCause", "jenkins.branch.BranchIndexingCause"},
+	"user":     {"hudson.model.Cause$UserIdCause", "hudson.model.Cause$UserCause"},
+	"upstream": {"hudson.model.Cause$UpstreamCause", "org.jenkinsci.plugins.workflow.support.steps.build.BuildUpstreamCause"},
+	// Replays of pipelines and the Rebuilder plugin, often used for debugging
+	"replay": {"org.jenkinsci.plugins.workflow.cps.replay.ReplayCause", "com.sonyericsson.rebuild.RebuildCause"},
+}
+
+func (t target) filtersByParams() bool {
+	return len(t.params) > 0 || len(t.excludeParams) > 0
+}
+
+// buildTree returns the tree selector for each build, extended with actions only when they are needed
+func (c *Client) buildTree(t target) string {
+	actions := make([]string, 0, 3)
+	if len(c.opts.OnlyCause) > 0 || len(c.opts.IgnoreCause) > 0 {
+		actions = append(actions, "causes[_class]")
+	}
+	if t.filtersByParams() || c.opts.ShowParams {
+		actions = append(actions, "parameters[name,value]")
+	}
+	if c.opts.ExcludeQueueTime {
+		actions = append(actions, "queuingDurationMillis")
+	}
+	fields := buildFields
+	if c.opts.ShowDisplayName {
+		fields += ",displayName"
+	}
+	if len(actions) == 0 {
+		return fields
+	}
+	return fmt.Sprintf("%s,actions[%s]", fields, strings.Join(actions, ","))
+}
+
+func (b build) hasCause(cause string) bool {
+	for _, a := range b.Actions {
+		for _, c := range a.Causes {
+			for _, class := range causeClasses[cause] {
+				if c.Class == class || strings.HasPrefix(c.Class, class+"$") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (b build) hasAnyCause(causes []string) bool {
+	for _, c := range causes {
+		if b.hasCause(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitParam splits a parameter filter of KEY=VALUE
+func splitParam(p string) (key, value string, ok bool) {
+	i := strings.Index(p, "=")
+	if i <= 0 {
+		return "", "", false
+	}
+	return p[:i], p[i+1:], true
+}
+
+func (b build) hasParam(p string) bool {
+	key, value, ok := splitParam(p)
+	if !ok {
+		return false
+	}
+	for _, a := range b.Actions {
+		for _, param := range a.Parameters {
+			if param.Name == key && fmt.Sprint(param.Value) == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasAllParams reports whether the build matches every filter, e.g. both ENV=production and REGION=eu
+func (b build) hasAllParams(params []string) bool {
+	for _, p := range params {
+		if !b.hasParam(p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b build) hasAnyParam(params []string) bool {
+	for _, p := range params {
+		if b.hasParam(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectBuilds drops builds not to be checked by the cause and parameter filters
+func (c *Client) selectBuilds(t target, builds []build) []build {
+	if len(c.opts.OnlyCause) == 0 && len(c.opts.IgnoreCause) == 0 && !t.filtersByParams() {
+		return builds
+	}
+	ret := make([]build, 0, len(builds))
+	for _, b := range builds {
+		if len(c.opts.OnlyCause) > 0 && !b.hasAnyCause(c.opts.OnlyCause) {
+			continue
+		}
+		if b.hasAnyCause(c.opts.IgnoreCause) {
+			continue
+		}
+		if !b.hasAllParams(t.params) || b.hasAnyParam(t.excludeParams) {
+			continue
+		}
+		ret = append(ret, b)
+	}
+	return ret
+}
+
+// params returns parameters of the build in KEY=VALUE
+func (b build) params() []string {
+	ret := make([]string, 0)
+	for _, a := range b.Actions {
+		for _, p := range a.Parameters {
+			ret = append(ret, fmt.Sprintf("%s=%v", p.Name, p.Value))
+		}
+	}
+	return ret
+}
+
+// buildLabel names the build in messages, with the display name and parameters if asked.
+// Display names same as the default `#57` are omitted.
+func (c *Client) buildLabel(b build) string {
+	l := fmt.Sprintf("Build id = %d", b.Number)
+	if c.opts.ShowDisplayName && b.DisplayName != "" && b.DisplayName != fmt.Sprintf("#%d", b.Number) {
+		l += fmt.Sprintf(" (%s)", b.DisplayName)
+	}
+	if ps := b.params(); c.opts.ShowParams && len(ps) > 0 {
+		l += fmt.Sprintf(" [%s]", strings.Join(ps, ", "))
+	}
+	return l
+}
@@ -0,0 +1,64 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+func (c *Client) healthURL() string {
+	return c.baseURL() + "/" + strings.TrimLeft(c.opts.HealthPath, "/")
+}
+
+// checkHealth measures how long Jenkins takes to answer a lightweight request.
+// Unlike the other modes, an unreachable Jenkins is critical since the availability is what is checked here.
+func (c *Client) checkHealth(ctx context.Context) *checkers.Checker {
+	start := time.Now()
+	// Only the last attempt is timed so that the retries and their intervals are not counted as latency
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) { start = time.Now() },
+	})
+	resp, err := c.fetch(ctx, c.healthURL(), c.defaultCredentials())
+	elapsed := time.Since(start)
+	if err != nil {
+		if isTimeoutError(err) {
+			if c.opts.Timeout > 0 {
+				return checkers.Critical(fmt.Sprintf("Jenkins did not respond within %s", c.opts.Timeout.Duration()))
+			}
+			return checkers.Critical("Jenkins did not respond in time")
+		}
+		return checkers.Critical(fmt.Sprintf("Jenkins is not reachable: %s", err))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return checkers.Critical(fmt.Sprintf("Jenkins responded %s in %s", resp.Status, elapsed.Round(time.Millisecond)))
+	}
+	msg := fmt.Sprintf("Jenkins responded in %s", elapsed.Round(time.Millisecond))
+	switch {
+	case elapsed >= c.opts.LatencyCritical.Duration():
+		return checkers.Critical(msg)
+	case elapsed >= c.opts.LatencyWarning.Duration():
+		return checkers.Warning(msg)
+	}
+	return checkers.Ok(msg)
+}
+
+func (c *Client) quietingDownURL() string {
+	return c.baseURL() + "/api/json?tree=quietingDown"
+}
+
+func (c *Client) isQuietingDown(ctx context.Context) (bool, error) {
+	var v struct {
+		QuietingDown bool `json:"quietingDown"`
+	}
+	err := c.fetchJSON(ctx, c.quietingDownURL(), c.defaultCredentials(), &v)
+	return v.QuietingDown, err
+}
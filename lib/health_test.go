@@ -0,0 +1,50 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+// TestHealthLatencyOfLastAttempt does not count the retries of the probe as latency
+func TestHealthLatencyOfLastAttempt(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+	ckr := testRun(t, srv.URL, "--check-health", "--retries", "1", "--retry-interval", "300ms", "--latency-warning", "200ms")
+	if ckr.Status != checkers.OK {
+		t.Errorf("status = %s, want %s: %s", ckr.Status, checkers.OK, ckr.Message)
+	}
+}
+
+// TestHealthTimeoutWithoutFlag does not report a timeout of 0s when --timeout is not given
+func TestHealthTimeoutWithoutFlag(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(done) })
+	c := testClient(t, srv.URL, "--check-health")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ckr := c.checkHealth(ctx)
+	if ckr.Status != checkers.CRITICAL || strings.Contains(ckr.Message, "0s") {
+		t.Errorf("%s %q, want a critical without the timeout", ckr.Status, ckr.Message)
+	}
+}
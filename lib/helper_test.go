@@ -0,0 +1,100 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+)
+
+// testNow is the clock of the tests, so that elapsed times of stub builds are exact
+var testNow = time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+func testClock() time.Time { return testNow }
+
+// stubBuild is a build in the response of the stub Jenkins, started the duration before testNow
+type stubBuild struct {
+	number   int
+	ago      time.Duration
+	duration time.Duration
+	result   string
+}
+
+func (b stubBuild) json() map[string]interface{} {
+	v := map[string]interface{}{
+		"number":    b.number,
+		"timestamp": testNow.Add(-b.ago).UnixNano() / int64(time.Millisecond),
+		"duration":  b.duration.Milliseconds(),
+		"building":  b.result == "",
+	}
+	if b.result != "" {
+		v["result"] = b.result
+	}
+	return v
+}
+
+// buildsJSON is the response of the job API with the builds
+func buildsJSON(bs ...stubBuild) string {
+	builds := make([]interface{}, 0, len(bs))
+	for _, b := range bs {
+		builds = append(builds, b.json())
+	}
+	b, _ := json.Marshal(map[string]interface{}{"builds": builds})
+	return string(b)
+}
+
+// stubJenkins answers the response of the first route whose key is a prefix of the path, and 404 otherwise
+func stubJenkins(t *testing.T, routes map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		longest := ""
+		for prefix := range routes {
+			if strings.HasPrefix(r.URL.Path, prefix) && len(prefix) > len(longest) {
+				longest = prefix
+			}
+		}
+		if longest == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(routes[longest]))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testOptions returns the options of the command line with --url of the stub Jenkins
+func testOptions(t *testing.T, url string, args ...string) Options {
+	t.Helper()
+	opts, err := NewOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseFlags(&opts, append([]string{"--url", url}, args...), flags.None); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// testClient returns the client checking the stub Jenkins at testNow
+func testClient(t *testing.T, url string, args ...string) *Client {
+	t.Helper()
+	return NewClient(testOptions(t, url, args...), WithClock(testClock))
+}
+
+// testRun checks the stub Jenkins once as the command line would
+func testRun(t *testing.T, url string, args ...string) *checkers.Checker {
+	t.Helper()
+	ckr, _ := testClient(t, url, args...).run(context.Background())
+	return ckr
+}
@@ -0,0 +1,492 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mackerelio/checkers"
+	"golang.org/x/net/proxy"
+)
+
+// baseURL returns `--url` if given, otherwise composes it from scheme, host and port.
+// A path in `--url` and `--prefix` are both kept for Jenkins served under a context path.
+// IPv6 hosts (e.g. 2001:db8::1) are bracketed, with or without the brackets in `--host`.
+func (c *Client) baseURL() string {
+	host := strings.TrimSuffix(strings.TrimPrefix(c.opts.Host, "["), "]")
+	u := (&url.URL{Scheme: c.opts.Scheme, Host: net.JoinHostPort(host, strconv.FormatInt(c.opts.Port, 10))}).String()
+	if c.opts.URL != "" {
+		u = strings.TrimRight(c.opts.URL, "/")
+	}
+	if p := strings.Trim(c.opts.Prefix, "/"); p != "" {
+		u += "/" + p
+	}
+	return u
+}
+
+// hostname returns the host part of the base URL
+func (c *Client) hostname() string {
+	u, err := url.Parse(c.baseURL())
+	if err != nil {
+		return c.opts.Host
+	}
+	return u.Hostname()
+}
+
+// jobPath expands a slash separated job name in folders (e.g. team-a/service-x/main)
+// to `/job/team-a/job/service-x/job/main`.
+// Each segment is escaped since names like `Deploy to Production (EU)` are common.
+func jobPath(name string) string {
+	var b strings.Builder
+	for _, seg := range strings.Split(strings.Trim(name, "/"), "/") {
+		b.WriteString("/job/")
+		b.WriteString(url.PathEscape(seg))
+	}
+	return b.String()
+}
+
+func (c *Client) jobURL(job, path string) string {
+	return c.baseURL() + jobPath(job) + path
+}
+
+// credentialExpiredError means that Jenkins rejected the credentials after accepting them earlier in the run
+type credentialExpiredError struct {
+	completed int64
+}
+
+func (e *credentialExpiredError) Error() string {
+	return fmt.Sprintf("credentials seem to have expired after checking %d jobs", e.completed)
+}
+
+func (c *Client) newTransport() (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// Requests all go to the one Jenkins, often in parallel with --concurrency and --scan-concurrency
+	t.MaxIdleConnsPerHost = t.MaxIdleConns
+	// HTTP/2 is negotiated by ALPN even with the custom TLS config and dialers below
+	t.ForceAttemptHTTP2 = true
+	if c.opts.Timeout > 0 {
+		t.DialContext = (&net.Dialer{Timeout: c.opts.Timeout.Duration(), KeepAlive: 30 * time.Second}).DialContext
+	}
+	t.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: c.opts.Insecure,
+	}
+	// The cloned transport honors HTTP_PROXY and friends unless the flags override it
+	switch {
+	case c.opts.Proxy != "" && c.opts.NoProxy:
+		return nil, errors.New("--proxy and --no-proxy are exclusive")
+	case c.opts.Proxy != "":
+		u, err := url.Parse(c.opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %s", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	case c.opts.NoProxy:
+		t.Proxy = nil
+	}
+	if c.opts.Socks5 != "" {
+		if c.opts.Proxy != "" {
+			return nil, errors.New("--proxy and --socks5 are exclusive")
+		}
+		var auth *proxy.Auth
+		if c.opts.Socks5User != "" {
+			auth = &proxy.Auth{User: c.opts.Socks5User, Password: c.opts.Socks5Password}
+		}
+		d, err := proxy.SOCKS5("tcp", c.opts.Socks5, auth, proxy.Direct)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOCKS5 proxy: %s", err)
+		}
+		t.Proxy = nil
+		t.DialContext = d.(proxy.ContextDialer).DialContext
+	}
+	if c.opts.UnixSocket != "" {
+		if c.opts.Socks5 != "" {
+			return nil, errors.New("--unix-socket and --socks5 are exclusive")
+		}
+		// The request URL is built as usual, only the connection goes to the socket
+		d := &net.Dialer{Timeout: c.opts.Timeout.Duration()}
+		t.Proxy = nil
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", c.opts.UnixSocket)
+		}
+	}
+	if c.opts.CAFile != "" {
+		pool, err := loadCAFile(c.opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	if c.opts.CertFile != "" || c.opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.opts.CertFile, c.opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	return t, nil
+}
+
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// fetchErrorChecker describes why fetching from Jenkins failed
+func (c *Client) fetchErrorChecker(err error) *checkers.Checker {
+	if e, ok := err.(*credentialExpiredError); ok {
+		return checkers.Unknown(fmt.Sprintf("Jenkins rejected the credentials partway through the run: %s", e))
+	}
+	if e, ok := err.(*inputError); ok {
+		return checkers.Unknown(e.Error())
+	}
+	if e, ok := err.(*httpStatusError); ok {
+		return checkers.NewChecker(parseStatus(c.opts.StatusOnHTTPError), e.Error())
+	}
+	// Jenkins answered something which is not its API, e.g. a login page, rather than being unreachable
+	var decodeErr *decodeError
+	if errors.As(err, &decodeErr) {
+		return checkers.Unknown(fmt.Sprintf("Failed to fetch jenkins metrics: %s", err))
+	}
+	st := parseStatus(c.opts.NetworkErrorAs)
+	if isTimeoutError(err) {
+		// The deadline may also be the one of the caller, e.g. mackerel-agent, whose length is not known here
+		if c.opts.Timeout > 0 {
+			return checkers.NewChecker(st, fmt.Sprintf("request timed out after %s", c.opts.Timeout.Duration()))
+		}
+		return checkers.NewChecker(st, "request timed out")
+	}
+	if isTLSError(err) {
+		return checkers.NewChecker(st, fmt.Sprintf("TLS handshake with Jenkins failed: %s", err))
+	}
+	return checkers.NewChecker(st, fmt.Sprintf("Failed to fetch jenkins metrics: %s", err))
+}
+
+// unknownAs replaces UNKNOWN with the status of `--unknown-as`
+func (c *Client) unknownAs(ckr *checkers.Checker) *checkers.Checker {
+	if ckr.Status != checkers.UNKNOWN || c.opts.UnknownAs == "unknown" {
+		return ckr
+	}
+	return checkers.NewChecker(parseStatus(c.opts.UnknownAs), ckr.Message)
+}
+
+// isTLSError reports whether err happened in the TLS handshake, e.g. the client certificate was rejected
+func isTLSError(err error) bool {
+	var hostErr x509.HostnameError
+	var authErr x509.UnknownAuthorityError
+	var certErr x509.CertificateInvalidError
+	var verifyErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	return errors.As(err, &hostErr) || errors.As(err, &authErr) || errors.As(err, &certErr) ||
+		errors.As(err, &verifyErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr)
+}
+
+func loadCAFile(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificate found in %s", path)
+	}
+	return pool, nil
+}
+
+// setupClient builds the HTTP client once per Client,
+// so that connections are kept alive across jobs and repeated checks of --watch and --serve.
+func (c *Client) setupClient() error {
+	c.setupOnce.Do(func() { c.setupErr = c.configureClient() })
+	return c.setupErr
+}
+
+func (c *Client) configureClient() error {
+	if err := c.applyNetrc(); err != nil {
+		return fmt.Errorf("failed to read netrc: %s", err)
+	}
+	switch {
+	case c.customHTTP != nil:
+		c.http = c.customHTTP
+	case c.transport != nil:
+		c.http = &http.Client{Transport: c.transport}
+	default:
+		t, err := c.newTransport()
+		if err != nil {
+			return err
+		}
+		c.http = &http.Client{Transport: t}
+	}
+	if c.opts.Negotiate {
+		return c.setupNegotiate()
+	}
+	return nil
+}
+
+// credentials for basic auth, which may differ per job
+type credentials struct {
+	user     string
+	apiToken string
+}
+
+func (c *Client) defaultCredentials() credentials {
+	c.credMu.RLock()
+	defer c.credMu.RUnlock()
+	if c.resolvedCred != nil {
+		return *c.resolvedCred
+	}
+	return credentials{c.opts.User, c.opts.APIToken}
+}
+
+func (c *Client) newRequest(ctx context.Context, method, url string, cred credentials) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range c.opts.Headers {
+		name, value, _ := splitHeader(h)
+		req.Header.Add(name, value)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.userAgent())
+	}
+	if c.opts.HostHeader != "" {
+		req.Host = c.opts.HostHeader
+	}
+	if c.opts.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.BearerToken)
+	} else if cred.user != "" || cred.apiToken != "" {
+		req.SetBasicAuth(cred.user, cred.apiToken)
+	}
+	if c.opts.Negotiate {
+		if err := c.setNegotiateHeader(req); err != nil {
+			return nil, err
+		}
+	}
+	if c.opts.IAPAudience != "" {
+		token, err := c.iapToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		header := "Authorization"
+		if req.Header.Get("Authorization") != "" {
+			header = "Proxy-Authorization"
+		}
+		req.Header.Set(header, "Bearer "+token)
+	}
+	return req, nil
+}
+
+func (c *Client) userAgent() string {
+	if c.opts.UserAgent != "" {
+		return c.opts.UserAgent
+	}
+	return "check-jenkins-build-time/" + version
+}
+
+// splitHeader splits a header given by `--header` as a line of HTTP
+func splitHeader(h string) (name, value string, ok bool) {
+	i := strings.Index(h, ":")
+	if i <= 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(h[:i]), strings.TrimSpace(h[i+1:]), true
+}
+
+// isTransient reports whether the request is worth retrying, e.g. while Jenkins is restarting
+func isTransient(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// retryAfter returns the wait asked by Retry-After of a 429 or 503 response, in seconds or an HTTP date
+func (c *Client) retryAfter(resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(c.now()); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// fitsDeadline reports whether ctx lasts longer than the wait, e.g. the timeout mackerel-agent gives the check
+func fitsDeadline(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > wait
+}
+
+// cancelBody releases the deadline of the request when the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// do sends the request with the deadline of `--timeout`, which lasts until the body is closed
+func (c *Client) do(ctx context.Context, method, url string, cred credentials) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if c.opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout.Duration())
+	}
+	req, err := c.newRequest(ctx, method, url, cred)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	if c.opts.Verbose {
+		logRequest(req, resp, err, time.Since(start))
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelBody{resp.Body, cancel}
+	if err := c.wrapBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// fetch GETs the url, see send
+func (c *Client) fetch(ctx context.Context, url string, cred credentials) (*http.Response, error) {
+	return c.send(ctx, "GET", url, cred)
+}
+
+// send retries up to `--retries` times on connection errors and 5xx, doubling `--retry-interval` each time
+func (c *Client) send(ctx context.Context, method, url string, cred credentials) (*http.Response, error) {
+	interval := c.opts.RetryInterval.Duration()
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(ctx, method, url, cred)
+		// Waits asked by Retry-After are spent from `--max-wait` instead of `--retries`.
+		// No wait, e.g. `Retry-After: 0` or a past date, is retried as usual so that it cannot loop forever.
+		if wait, ok := c.retryAfter(resp, err); ok && wait > 0 && waited+wait <= c.opts.MaxWait.Duration() && fitsDeadline(ctx, wait) {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+			waited += wait
+			attempt--
+			continue
+		}
+		if attempt < c.opts.Retries && isTransient(resp, err) && ctx.Err() == nil {
+			if err == nil {
+				// Draining the body lets the connection be reused for the retry
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(interval):
+			}
+			interval *= 2
+			continue
+		}
+		return resp, err
+	}
+}
+
+func (c *Client) fetchJSON(ctx context.Context, url string, cred credentials, v interface{}) error {
+	resp, err := c.fetch(ctx, url, cred)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		if n := atomic.LoadInt64(&c.completedJobs); n > 0 {
+			return &credentialExpiredError{n}
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &httpStatusError{resp.StatusCode, resp.Status}
+	}
+	return decodeJSON(resp, v)
+}
+
+// decodeError keeps a part of the body since a login page or a proxy error page is a common cause
+type decodeError struct {
+	contentType string
+	snippet     string
+	err         error
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("failed to decode the response (Content-Type: %s): %s: %q", e.contentType, e.err, e.snippet)
+}
+
+const snippetLength = 200
+
+func decodeJSON(resp *http.Response, v interface{}) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		snippet := string(body)
+		if len(snippet) > snippetLength {
+			snippet = snippet[:snippetLength] + "..."
+		}
+		return &decodeError{resp.Header.Get("Content-Type"), snippet, err}
+	}
+	return nil
+}
+
+func isAuthError(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// httpStatusError is returned when Jenkins answers other than 200
+type httpStatusError struct {
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string {
+	switch {
+	case isAuthError(e.code):
+		return fmt.Sprintf("jenkins rejected the credentials: %s", e.status)
+	case e.code == http.StatusNotFound:
+		return fmt.Sprintf("job is not found: %s", e.status)
+	case e.code >= 500:
+		return fmt.Sprintf("jenkins failed to respond: %s", e.status)
+	}
+	return fmt.Sprintf("unexpected status: %s", e.status)
+}
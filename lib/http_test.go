@@ -0,0 +1,185 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mackerelio/checkers"
+)
+
+// TestCredentialExpired fails the second of three jobs with 401, which is told expired from the first job checked
+func TestCredentialExpired(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/job/b/") {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(buildsJSON(stubBuild{number: 1, ago: time.Hour, duration: time.Second, result: "SUCCESS"})))
+	}))
+	defer srv.Close()
+	c := testClient(t, srv.URL, "-j", "a", "-j", "b", "-j", "c", "--concurrency", "1")
+
+	// The jobs are counted anew in each run
+	for run := 0; run < 2; run++ {
+		_, results := c.run(context.Background())
+		if len(results) != 3 {
+			t.Fatalf("got %d results, want 3", len(results))
+		}
+		if _, ok := results[1].err.(*credentialExpiredError); !ok {
+			t.Fatalf("run %d: error of job b = %v, want credentialExpiredError", run, results[1].err)
+		}
+		if want := "after checking 1 jobs"; !strings.Contains(results[1].checker.Message, want) {
+			t.Errorf("run %d: message = %q, want it to contain %q", run, results[1].checker.Message, want)
+		}
+	}
+}
+
+// TestCredentialRejected fails the first job with 401, which is not told expired
+func TestCredentialRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	_, results := testClient(t, srv.URL, "-j", "a").run(context.Background())
+	if _, ok := results[0].err.(*httpStatusError); !ok {
+		t.Errorf("error = %v, want httpStatusError", results[0].err)
+	}
+}
+
+func TestHostHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"override", []string{"--host-header", "jenkins.example.com"}, "jenkins.example.com"},
+		{"override with the port", []string{"--host-header", "jenkins.example.com:8443"}, "jenkins.example.com:8443"},
+		{"default", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var host string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				host = r.Host
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(buildsJSON()))
+			}))
+			defer srv.Close()
+			want := tt.want
+			if want == "" {
+				want = strings.TrimPrefix(srv.URL, "http://")
+			}
+			testRun(t, srv.URL, append([]string{"-j", "deploy"}, tt.args...)...)
+			if host != want {
+				t.Errorf("Host = %q, want %q", host, want)
+			}
+		})
+	}
+}
+
+func TestJobPath(t *testing.T) {
+	tests := []struct {
+		job  string
+		want string
+	}{
+		{"deploy", "/job/deploy"},
+		{"Deploy to Production (EU)", "/job/Deploy%20to%20Production%20%28EU%29"},
+		{"team/デプロイ", "/job/team/job/%E3%83%87%E3%83%97%E3%83%AD%E3%82%A4"},
+		{"/team/deploy/", "/job/team/job/deploy"},
+		{"coverage 100%", "/job/coverage%20100%25"},
+	}
+	for _, tt := range tests {
+		if got := jobPath(tt.job); got != tt.want {
+			t.Errorf("jobPath(%q) = %q, want %q", tt.job, got, tt.want)
+		}
+	}
+}
+
+// TestEscapedJobNames checks jobs with spaces, parentheses and unicode in their names against a stub Jenkins
+func TestEscapedJobNames(t *testing.T) {
+	for _, job := range []string{"Deploy to Production (EU)", "team/デプロイ 本番"} {
+		t.Run(job, func(t *testing.T) {
+			var path string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(buildsJSON(stubBuild{number: 1, ago: time.Minute, duration: time.Second, result: "SUCCESS"})))
+			}))
+			defer srv.Close()
+			ckr := testRun(t, srv.URL, "-j", job)
+			if want := "/job/" + strings.Replace(job, "/", "/job/", -1) + "/api/json"; path != want {
+				t.Errorf("path = %q, want %q", path, want)
+			}
+			if ckr.Status != checkers.OK {
+				t.Errorf("status = %s, want OK: %s", ckr.Status, ckr.Message)
+			}
+		})
+	}
+}
+
+func TestBaseURLIPv6(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"literal", []string{"--host", "2001:db8::1"}, "http://[2001:db8::1]:8080"},
+		{"bracketed literal", []string{"--host", "[2001:db8::1]"}, "http://[2001:db8::1]:8080"},
+		{"loopback with the port", []string{"--host", "::1", "--port", "9090"}, "http://[::1]:9090"},
+		{"scheme", []string{"--host", "::1", "--scheme", "https", "--port", "443"}, "https://[::1]:443"},
+		{"URL with the port", []string{"--url", "http://[2001:db8::1]:9090/"}, "http://[2001:db8::1]:9090"},
+		{"URL without a port", []string{"--url", "https://[2001:db8::1]"}, "https://[2001:db8::1]"},
+		{"IPv4", []string{"--host", "192.0.2.1"}, "http://192.0.2.1:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := NewOptions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := parseFlags(&opts, append([]string{"-j", "deploy"}, tt.args...), flags.None); err != nil {
+				t.Fatal(err)
+			}
+			if got := NewClient(opts).baseURL(); got != tt.want {
+				t.Errorf("baseURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestIPv6Jenkins checks a stub Jenkins listening on the IPv6 loopback given by --host and --port
+func TestIPv6Jenkins(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 is not available: %s", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(buildsJSON(stubBuild{number: 1, ago: time.Minute, duration: time.Second, result: "SUCCESS"})))
+	}))
+	srv.Listener.Close()
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	opts, err := NewOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseFlags(&opts, []string{"-j", "deploy", "--host", "::1", "--port", port}, flags.None); err != nil {
+		t.Fatal(err)
+	}
+	ckr, _ := NewClient(opts, WithClock(testClock)).run(context.Background())
+	if ckr.Status != checkers.OK {
+		t.Errorf("status = %s, want OK: %s", ckr.Status, ckr.Message)
+	}
+}
@@ -0,0 +1,183 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+Jenkins behind Google Identity-Aware Proxy is accessed with an ID token for the OAuth client ID of IAP given by `--iap-audience`.
+The token is issued by the metadata server on GCE, or for the service account key given by `--iap-credentials`.
+It is sent in Authorization, or in Proxy-Authorization when Authorization carries the credentials of Jenkins.
+*/
+
+const metadataIdentityURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/identity"
+
+// iapRefreshMargin renews the token before it expires while checking repeatedly
+const iapRefreshMargin = 5 * time.Minute
+
+type serviceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// iapToken returns the ID token, fetching a new one when it is about to expire
+func (c *Client) iapToken(ctx context.Context) (string, error) {
+	c.iapMu.Lock()
+	defer c.iapMu.Unlock()
+	if c.iapIDToken != "" && c.now().Add(iapRefreshMargin).Before(c.iapExpiry) {
+		return c.iapIDToken, nil
+	}
+	var token string
+	var err error
+	if c.opts.IAPCredentials != "" {
+		token, err = c.fetchServiceAccountIDToken(ctx)
+	} else {
+		token, err = fetchMetadataIDToken(ctx, c.metadataClient(), c.opts.IAPAudience)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get an ID token for IAP: %s", err)
+	}
+	exp, err := tokenExpiry(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to get an ID token for IAP: %s", err)
+	}
+	c.iapIDToken, c.iapExpiry = token, exp
+	return token, nil
+}
+
+func fetchMetadataIDToken(ctx context.Context, hc *http.Client, audience string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", metadataIdentityURL+"?format=full&audience="+url.QueryEscape(audience), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server answered %s", resp.Status)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// fetchServiceAccountIDToken exchanges a JWT signed by the service account key for an ID token
+func (c *Client) fetchServiceAccountIDToken(ctx context.Context) (string, error) {
+	b, err := ioutil.ReadFile(c.opts.IAPCredentials)
+	if err != nil {
+		return "", err
+	}
+	var key serviceAccountKey
+	if err := json.Unmarshal(b, &key); err != nil {
+		return "", fmt.Errorf("invalid service account key %s: %s", c.opts.IAPCredentials, err)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	now := c.now()
+	assertion, err := signJWT(key.PrivateKey, map[string]interface{}{
+		"iss":             key.ClientEmail,
+		"sub":             key.ClientEmail,
+		"aud":             key.TokenURI,
+		"target_audience": c.opts.IAPAudience,
+		"iat":             now.Unix(),
+		"exp":             now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, "POST", key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.outboundClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint answered %s", resp.Status)
+	}
+	var tr struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", err
+	}
+	if tr.IDToken == "" {
+		return "", errors.New("token endpoint answered no id_token")
+	}
+	return tr.IDToken, nil
+}
+
+// signJWT signs the claims with RS256 by the PEM encoded private key of the service account
+func signJWT(privateKey string, claims map[string]interface{}) (string, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return "", errors.New("invalid private key of the service account")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", err
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("private key of the service account is not RSA")
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + enc.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// tokenExpiry reads exp of the JWT without verifying it, which is left to IAP
+func tokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("the ID token is not a JWT")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, err
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
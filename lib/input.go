@@ -0,0 +1,72 @@
+package checkjenkinsbuildtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// inputJob is the job of `--input` when no `--job-name` is given, only used in messages
+const inputJob = "input"
+
+// inputTarget returns the target evaluated with `--input`
+func (c *Client) inputTarget(warning, critical time.Duration) target {
+	job := inputJob
+	if len(c.opts.JobNames) > 0 {
+		job = c.opts.JobNames[0]
+	}
+	return c.newTarget(job, warning, critical)
+}
+
+// readInputBuilds decodes the saved API response of `--input` instead of fetching it.
+// Both the response of the job, with `builds`, and the one of a build are accepted.
+func (c *Client) readInputBuilds() (builds, error) {
+	bs, err := c.decodeInput()
+	if err != nil {
+		return builds{}, &inputError{err}
+	}
+	return c.normalizeBuilds(bs), nil
+}
+
+// inputError is a failure to read `--input`, which is not worth retrying or remapping like network errors
+type inputError struct {
+	err error
+}
+
+func (e *inputError) Error() string {
+	return fmt.Sprintf("failed to read the input: %s", e.err)
+}
+
+func (c *Client) decodeInput() (builds, error) {
+	var r io.Reader = os.Stdin
+	if c.opts.Input != "-" {
+		f, err := os.Open(c.opts.Input)
+		if err != nil {
+			return builds{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return builds{}, err
+	}
+	var bs builds
+	if err := json.Unmarshal(raw, &bs); err != nil {
+		return builds{}, err
+	}
+	if bs.Builds == nil {
+		var b build
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return builds{}, err
+		}
+		if b.Number == 0 {
+			return builds{}, errors.New("neither builds nor a build is found")
+		}
+		bs.Builds = []build{b}
+	}
+	return bs, nil
+}
@@ -0,0 +1,337 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+type childJobs struct {
+	Jobs []struct {
+		Name string `json:"name"`
+	} `json:"jobs"`
+}
+
+func (c childJobs) names() []string {
+	names := make([]string, 0, len(c.Jobs))
+	for _, j := range c.Jobs {
+		names = append(names, j.Name)
+	}
+	return names
+}
+
+// listJobs returns names of jobs directly under the item of the API URL
+func (c *Client) listJobs(ctx context.Context, apiURL string) ([]string, error) {
+	var children childJobs
+	if err := c.fetchJSON(ctx, apiURL+"?tree=jobs[name]", c.defaultCredentials(), &children); err != nil {
+		return nil, err
+	}
+	return children.names(), nil
+}
+
+// listChildJobs returns names of jobs directly under the folder or the multibranch pipeline.
+// Branch names are returned as Jenkins encodes them in URLs (e.g. `feature%2Ffoo` for the branch feature/foo).
+func (c *Client) listChildJobs(ctx context.Context, parent target) ([]string, error) {
+	var children childJobs
+	if err := c.fetchJobJSON(ctx, parent, "/api/json?tree=jobs[name]", &children); err != nil {
+		return nil, err
+	}
+	return children.names(), nil
+}
+
+// listJobsByRegex returns top-level jobs whose names match `--job-regex`
+func (c *Client) listJobsByRegex(ctx context.Context, pattern string) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job regex: %s", err)
+	}
+	names, err := c.listJobs(ctx, c.baseURL()+"/api/json")
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]string, 0)
+	for _, n := range names {
+		if re.MatchString(n) {
+			jobs = append(jobs, n)
+		}
+	}
+	return jobs, nil
+}
+
+// readJobsFile returns the jobs listed one per line in `--jobs-file`, skipping blank lines and comments by #
+func readJobsFile(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the jobs file: %s", err)
+	}
+	jobs := make([]string, 0)
+	for _, l := range strings.Split(string(b), "\n") {
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "#") {
+			jobs = append(jobs, l)
+		}
+	}
+	return jobs, nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// selectBranch applies `--include-branch` and `--exclude-branch` to the decoded branch name
+func (c *Client) selectBranch(name string) bool {
+	if decoded, err := url.PathUnescape(name); err == nil {
+		name = decoded
+	}
+	if len(c.opts.IncludeBranch) > 0 && !matchAny(c.opts.IncludeBranch, name) {
+		return false
+	}
+	return !matchAny(c.opts.ExcludeBranch, name)
+}
+
+// isSingleJob reports whether exactly one job is given explicitly,
+// in which case the result is reported without the job name as before.
+func (o *Options) isSingleJob() bool {
+	if o.Input != "" {
+		return true
+	}
+	return len(o.JobNames) == 1 && o.JobsFile == "" && o.JobRegex == "" && o.View == "" && o.Config == "" && !o.Multibranch
+}
+
+// hasJobSelector reports whether any of the flags selecting jobs is given
+func (o *Options) hasJobSelector() bool {
+	return len(o.JobNames) > 0 || o.JobsFile != "" || o.JobRegex != "" || o.View != "" || o.Config != ""
+}
+
+// target is a job to check with the settings which may differ per job
+type target struct {
+	job          string
+	warning      time.Duration
+	critical     time.Duration
+	maxJobNumber int64
+	cred         credentials
+	// branch is set when the last segment of job is a branch of a multibranch pipeline
+	branch bool
+	// params and excludeParams filter builds by parameters in KEY=VALUE
+	params        []string
+	excludeParams []string
+	// instance is set for jobs of another Jenkins in the config
+	instance *instance
+}
+
+// client returns the client fetching the job, c unless the job is of another Jenkins
+func (t target) client(c *Client) *Client {
+	if t.instance != nil {
+		return t.instance.client
+	}
+	return c
+}
+
+// label is the name of the job in results
+func (t target) label() string {
+	if t.instance != nil {
+		return t.instance.name + ":" + t.job
+	}
+	return t.job
+}
+
+// newTarget returns a target with the settings given by flags
+func (c *Client) newTarget(job string, warning, critical time.Duration) target {
+	return target{
+		job:           job,
+		warning:       warning,
+		critical:      critical,
+		maxJobNumber:  c.opts.MaxJobNumber,
+		cred:          c.defaultCredentials(),
+		params:        c.opts.Params,
+		excludeParams: c.opts.ExcludeParams,
+	}
+}
+
+// fetchJobJSON fetches the path under the job URL with the credentials of the target
+func (c *Client) fetchJobJSON(ctx context.Context, t target, path string, v interface{}) error {
+	return c.fetchJSON(ctx, c.jobURL(t.job, path), t.cred, v)
+}
+
+// isInstanceCheck reports whether a check of the Jenkins instance rather than jobs is given
+func (o *Options) isInstanceCheck() bool {
+	return o.CheckExecutors || o.CheckNodes || o.CheckHealth
+}
+
+// targetJobs returns the jobs to check
+func (c *Client) targetJobs(ctx context.Context, warning, critical time.Duration) ([]target, error) {
+	var conf *config
+	if c.opts.Config != "" {
+		var err error
+		if conf, err = loadConfig(c.opts.Config); err != nil {
+			return nil, err
+		}
+		if warning, critical, err = c.scheduled(conf.Schedules, warning, critical); err != nil {
+			return nil, err
+		}
+	}
+	names := c.opts.JobNames
+	if c.opts.JobsFile != "" {
+		listed, err := readJobsFile(c.opts.JobsFile)
+		if err != nil {
+			return nil, err
+		}
+		names = append(append([]string{}, names...), listed...)
+	}
+	if c.opts.JobRegex != "" {
+		matched, err := c.listJobsByRegex(ctx, c.opts.JobRegex)
+		if err != nil {
+			return nil, err
+		}
+		names = append(append([]string{}, names...), matched...)
+	}
+	if c.opts.View != "" {
+		viewJobs, err := c.listJobs(ctx, fmt.Sprintf("%s/view/%s/api/json", c.baseURL(), url.PathEscape(c.opts.View)))
+		if err != nil {
+			return nil, err
+		}
+		names = append(append([]string{}, names...), viewJobs...)
+	}
+
+	targets := make([]target, 0, len(names))
+	for _, n := range names {
+		targets = append(targets, c.newTarget(n, warning, critical))
+	}
+	if conf != nil {
+		confTargets, err := c.targets(conf.Jobs, warning, critical)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, confTargets...)
+		for _, inst := range conf.Instances {
+			instTargets, err := c.instanceTargets(ctx, inst, warning, critical)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, instTargets...)
+		}
+	}
+
+	if !c.opts.Multibranch {
+		return targets, nil
+	}
+	jobs := make([]target, 0)
+	for _, parent := range targets {
+		branches, err := parent.client(c).listChildJobs(ctx, parent)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range branches {
+			if c.selectBranch(b) {
+				child := parent
+				child.job = strings.TrimRight(parent.job, "/") + "/" + b
+				child.branch = true
+				jobs = append(jobs, child)
+			}
+		}
+	}
+	return jobs, nil
+}
+
+type jobResult struct {
+	job     string
+	checker *checkers.Checker
+	// builds are numbers of the builds over the thresholds
+	builds      []int
+	evaluations []buildEvaluation
+	// err is the failure to fetch the builds, which the checker reports as well
+	err error
+	// started and finished are when the job was checked, for the spans of `--otel-endpoint`
+	started  time.Time
+	finished time.Time
+}
+
+// checkJobs checks the targets with `concurrency` workers, keeping the order of the targets in the results
+func (c *Client) checkJobs(ctx context.Context, targets []target, concurrency int) []jobResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]jobResult, len(targets))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				started := time.Now()
+				jc := targets[i].client(c)
+				results[i] = jc.checkJob(ctx, targets[i])
+				if results[i].err == nil {
+					atomic.AddInt64(&jc.completedJobs, 1)
+				}
+				results[i].started, results[i].finished = started, time.Now()
+				results[i].job = targets[i].label()
+				// Mapped per job so that the worst status of the jobs is picked after the mapping
+				results[i].checker = c.unknownAs(results[i].checker)
+			}
+		}()
+	}
+	for i := range targets {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// severity orders statuses to pick the worst one, CRITICAL being the worst
+func severity(st checkers.Status) int {
+	switch st {
+	case checkers.OK:
+		return 0
+	case checkers.UNKNOWN:
+		return 1
+	case checkers.WARNING:
+		return 2
+	}
+	return 3
+}
+
+// worse returns the checker with the worse status, where nil means nothing to report
+func worse(a, b *checkers.Checker) *checkers.Checker {
+	if a == nil {
+		return b
+	}
+	if b != nil && severity(b.Status) > severity(a.Status) {
+		return b
+	}
+	return a
+}
+
+// aggregate merges results of jobs into one checker, where the worst status wins
+// and the message lists every job that is not OK.
+func aggregate(results []jobResult) *checkers.Checker {
+	st := checkers.OK
+	msgs := make([]string, 0)
+	for _, r := range results {
+		if severity(r.checker.Status) > severity(st) {
+			st = r.checker.Status
+		}
+		if r.checker.Status != checkers.OK {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", r.job, r.checker.Message))
+		}
+	}
+	if len(msgs) == 0 {
+		return checkers.NewChecker(st, fmt.Sprintf("No build that takes too long time exists in %d jobs", len(results)))
+	}
+	return checkers.NewChecker(st, strings.Join(msgs, ", "))
+}
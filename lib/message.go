@@ -0,0 +1,60 @@
+package checkjenkinsbuildtime
+
+import (
+	"bytes"
+	"log"
+	"text/template"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+// messageData is what `--message-template` is executed with for every build over the thresholds, e.g.
+//
+//	--message-template '{{.Job}} #{{.Number}} is running for {{.Elapsed}} (limit {{.Threshold}}) {{.URL}}'
+type messageData struct {
+	Job         string
+	Number      int
+	DisplayName string
+	Status      string
+	Running     bool
+	Elapsed     time.Duration
+	Threshold   time.Duration
+	URL         string
+	// Message is the message reported without the template
+	Message string
+}
+
+func parseMessageTemplate(s string) (*template.Template, error) {
+	return template.New("message").Option("missingkey=error").Parse(s)
+}
+
+// renderMessage executes `--message-template` for the build, falling back to the default message if it fails
+func (c *Client) renderMessage(t target, b build, st checkers.Status, threshold time.Duration, msg string) string {
+	elapsed := b.executionTime()
+	if b.isUnfinished() {
+		elapsed = c.now().Sub(b.startedAt()).Round(time.Second)
+	}
+	tmpl, err := parseMessageTemplate(c.opts.MessageTemplate)
+	if err != nil {
+		log.Printf("Failed to parse the message template: %s", err)
+		return msg
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, messageData{
+		Job:         t.label(),
+		Number:      b.Number,
+		DisplayName: b.DisplayName,
+		Status:      st.String(),
+		Running:     b.isUnfinished(),
+		Elapsed:     elapsed,
+		Threshold:   threshold,
+		URL:         c.buildURL(t, b),
+		Message:     msg,
+	})
+	if err != nil {
+		log.Printf("Failed to execute the message template: %s", err)
+		return msg
+	}
+	return buf.String()
+}
@@ -0,0 +1,102 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// metricPrefix is the top of the metric names, as `jenkins.build_time.<job>.running_elapsed`
+const metricPrefix = "jenkins.build_time"
+
+// invalidMetricChars are replaced in job names, which mackerel-agent does not accept in metric names
+var invalidMetricChars = regexp.MustCompile(`[^-a-zA-Z0-9_]`)
+
+type graphMetric struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+type graphDef struct {
+	Label   string        `json:"label"`
+	Unit    string        `json:"unit"`
+	Metrics []graphMetric `json:"metrics"`
+}
+
+func printGraphDef() error {
+	meta := struct {
+		Graphs map[string]graphDef `json:"graphs"`
+	}{
+		Graphs: map[string]graphDef{
+			metricPrefix + ".#": {
+				Label: "Jenkins Build Time (seconds)",
+				Unit:  "float",
+				Metrics: []graphMetric{
+					{"running_elapsed", "Longest running"},
+					{"last_duration", "Last completed"},
+					{"average_duration", "Recent average"},
+				},
+			},
+		},
+	}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	fmt.Println("# mackerel-agent-plugin")
+	fmt.Println(string(b))
+	return nil
+}
+
+// jobMetrics returns the longest elapsed time of running builds, the duration of the last completed build
+// and the average duration of recent completed builds in seconds, leaving out ones which are unknown
+func jobMetrics(r jobResult) map[string]float64 {
+	m := map[string]float64{"running_elapsed": 0}
+	var sum float64
+	finished := 0
+	for _, e := range r.evaluations {
+		if e.Running {
+			if e.ElapsedSeconds > m["running_elapsed"] {
+				m["running_elapsed"] = e.ElapsedSeconds
+			}
+			continue
+		}
+		if finished == 0 {
+			m["last_duration"] = e.ElapsedSeconds
+		}
+		sum += e.ElapsedSeconds
+		finished++
+	}
+	if finished > 0 {
+		m["average_duration"] = sum / float64(finished)
+	}
+	return m
+}
+
+// printMetrics runs the check of jobs and prints metrics in the format of mackerel-plugin,
+// or the graph definitions when mackerel-agent asks for them
+func (c *Client) printMetrics(ctx context.Context, meta bool) error {
+	if meta {
+		return printGraphDef()
+	}
+	ckr, results := c.run(ctx)
+	if results == nil {
+		return fmt.Errorf("failed to get build durations: %s", ckr.Message)
+	}
+	now := c.now().Unix()
+	for _, r := range results {
+		// Builds of the job could not be fetched
+		if r.err != nil {
+			continue
+		}
+		key := invalidMetricChars.ReplaceAllString(r.job, "_")
+		m := jobMetrics(r)
+		for _, name := range []string{"running_elapsed", "last_duration", "average_duration"} {
+			if v, ok := m[name]; ok {
+				fmt.Printf("%s.%s.%s\t%f\t%d\n", metricPrefix, key, name, v, now)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package checkjenkinsbuildtime
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	krbcredentials "github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// defaultCCachePath follows MIT Kerberos: $KRB5CCNAME, or /tmp/krb5cc_<uid>
+func defaultCCachePath() string {
+	if p := os.Getenv("KRB5CCNAME"); p != "" {
+		return strings.TrimPrefix(p, "FILE:")
+	}
+	return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+}
+
+// setupNegotiate logs in with the keytab if `--keytab` is given, otherwise with the credential cache
+func (c *Client) setupNegotiate() error {
+	cfg, err := krbconfig.Load(c.opts.Krb5Config)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %s", c.opts.Krb5Config, err)
+	}
+
+	if c.opts.Keytab != "" {
+		kt, err := keytab.Load(c.opts.Keytab)
+		if err != nil {
+			return fmt.Errorf("failed to load keytab: %s", err)
+		}
+		user := c.opts.Krb5Principal
+		realm := cfg.LibDefaults.DefaultRealm
+		if i := strings.LastIndex(user, "@"); i >= 0 {
+			user, realm = user[:i], user[i+1:]
+		}
+		c.krb = krbclient.NewWithKeytab(user, realm, kt, cfg)
+		if err := c.krb.Login(); err != nil {
+			return fmt.Errorf("kerberos login failed: %s", err)
+		}
+		return nil
+	}
+
+	ccache, err := krbcredentials.LoadCCache(defaultCCachePath())
+	if err != nil {
+		return fmt.Errorf("failed to load credential cache: %s", err)
+	}
+	c.krb, err = krbclient.NewFromCCache(ccache, cfg)
+	if err != nil {
+		return fmt.Errorf("kerberos login failed: %s", err)
+	}
+	return nil
+}
+
+// setNegotiateHeader sets the SPNEGO token for the HTTP/<host> service principal
+func (c *Client) setNegotiateHeader(req *http.Request) error {
+	return spnego.SetSPNEGOHeader(c.krb, req, "")
+}
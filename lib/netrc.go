@@ -0,0 +1,91 @@
+package checkjenkinsbuildtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+func defaultNetrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".netrc")
+}
+
+// parseNetrc returns the entry of the machine, falling back to the `default` entry
+func parseNetrc(data, machine string) (netrcEntry, bool) {
+	var found, def *netrcEntry
+	var cur *netrcEntry
+	tokens := strings.Fields(data)
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			cur = nil
+			if i+1 < len(tokens) {
+				i++
+				if tokens[i] == machine && found == nil {
+					found = &netrcEntry{}
+					cur = found
+				}
+			}
+		case "default":
+			def = &netrcEntry{}
+			cur = def
+		case "login", "password", "account":
+			if i+1 >= len(tokens) {
+				break
+			}
+			i++
+			if cur == nil {
+				continue
+			}
+			if tokens[i-1] == "login" {
+				cur.login = tokens[i]
+			} else if tokens[i-1] == "password" {
+				cur.password = tokens[i]
+			}
+		case "macdef":
+			// macro definitions are irrelevant to us and run until a blank line, which Fields cannot see.
+			// Stop here as `macdef` conventionally comes last.
+			i = len(tokens)
+		}
+	}
+	if found != nil {
+		return *found, true
+	}
+	if def != nil {
+		return *def, true
+	}
+	return netrcEntry{}, false
+}
+
+// applyNetrc fills basic auth credentials from the netrc file unless they are given explicitly
+func (c *Client) applyNetrc() error {
+	if !c.opts.Netrc && c.opts.NetrcFile == "" {
+		return nil
+	}
+	if c.opts.User != "" || c.opts.APIToken != "" || c.opts.hasCredentialSource() {
+		return nil
+	}
+	path := c.opts.NetrcFile
+	if path == "" {
+		path = defaultNetrcPath()
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if e, ok := parseNetrc(string(data), c.hostname()); ok {
+		c.opts.User = e.login
+		c.opts.APIToken = e.password
+	}
+	return nil
+}
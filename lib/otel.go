@@ -0,0 +1,185 @@
+package checkjenkinsbuildtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+/*
+A span of the check run and a child span per job are exported to `--otel-endpoint` by OTLP/HTTP in JSON,
+which collectors accept at /v1/traces without the SDK.
+
+% curl -s -X POST http://localhost:4318/v1/traces -H "Content-Type: application/json" -d '{"resourceSpans": [...]}'
+{"partialSuccess":{}}
+*/
+
+const otelTimeout = 5 * time.Second
+
+type otelValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otelAttribute struct {
+	Key   string    `json:"key"`
+	Value otelValue `json:"value"`
+}
+
+func stringAttribute(k, v string) otelAttribute {
+	return otelAttribute{k, otelValue{StringValue: &v}}
+}
+
+// intAttribute is encoded as a string since OTLP/JSON encodes 64 bit integers so
+func intAttribute(k string, v int64) otelAttribute {
+	s := strconv.FormatInt(v, 10)
+	return otelAttribute{k, otelValue{IntValue: &s}}
+}
+
+func doubleAttribute(k string, v float64) otelAttribute {
+	return otelAttribute{k, otelValue{DoubleValue: &v}}
+}
+
+type otelStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otelSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otelAttribute `json:"attributes"`
+	Status       otelStatus      `json:"status"`
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// spanStatus marks CRITICAL and UNKNOWN as errors, leaving WARNING unset as it is not a failure of the check
+func spanStatus(ckr *checkers.Checker) otelStatus {
+	switch ckr.Status {
+	case checkers.CRITICAL, checkers.UNKNOWN:
+		return otelStatus{2, ckr.Message}
+	}
+	return otelStatus{}
+}
+
+// jobSpanAttributes describe the job by the build over the thresholds, or the newest build
+func jobSpanAttributes(r jobResult) []otelAttribute {
+	attrs := []otelAttribute{stringAttribute("jenkins.job", r.job), stringAttribute("check.status", r.checker.Status.String())}
+	number := 0
+	if len(r.builds) > 0 {
+		number = r.builds[0]
+	} else if len(r.evaluations) > 0 {
+		number = r.evaluations[0].Number
+	}
+	for _, e := range r.evaluations {
+		if e.Number == number {
+			attrs = append(attrs, intAttribute("jenkins.build.number", int64(e.Number)), doubleAttribute("jenkins.build.elapsed_seconds", e.ElapsedSeconds))
+			break
+		}
+	}
+	return attrs
+}
+
+// otelURL adds /v1/traces to the endpoint given without a path, as OTEL_EXPORTER_OTLP_ENDPOINT does
+func otelURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// exportTrace sends the spans of the check run which took from start until now
+func (c *Client) exportTrace(start time.Time, ckr *checkers.Checker, results []jobResult) error {
+	end := time.Now()
+	traceID, rootID := randomID(16), randomID(8)
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "check-jenkins-build-time"
+	}
+	spans := []otelSpan{{
+		TraceID: traceID, SpanID: rootID, Name: "check", Kind: 1,
+		Start: unixNano(start), End: unixNano(end),
+		Attributes: []otelAttribute{stringAttribute("check.name", c.opts.checkName()), stringAttribute("check.status", ckr.Status.String()), stringAttribute("jenkins.url", c.baseURL()), intAttribute("check.jobs", int64(len(results)))},
+		Status:     spanStatus(ckr),
+	}}
+	for _, r := range results {
+		s, e := r.started, r.finished
+		if s.IsZero() {
+			s, e = start, end
+		}
+		spans = append(spans, otelSpan{
+			TraceID: traceID, SpanID: randomID(8), ParentSpanID: rootID, Name: "check job", Kind: 3,
+			Start: unixNano(s), End: unixNano(e), Attributes: jobSpanAttributes(r), Status: spanStatus(r.checker),
+		})
+	}
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": []otelAttribute{stringAttribute("service.name", service)}},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "check-jenkins-build-time", "version": version},
+				"spans": spans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	u, err := otelURL(c.opts.OTelEndpoint)
+	if err != nil {
+		return err
+	}
+	// The export has its own timeout so that it is sent even after the check ran out of its time
+	ctx, cancel := context.WithTimeout(context.Background(), otelTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// e.g. OTEL_EXPORTER_OTLP_HEADERS="api-key=xxx,team=ci"
+	for _, h := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if k, v, ok := splitParam(strings.TrimSpace(h)); ok {
+			req.Header.Set(strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+	resp, err := c.outboundClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("the collector answered %s", resp.Status)
+	}
+	return nil
+}
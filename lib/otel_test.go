@@ -0,0 +1,27 @@
+package checkjenkinsbuildtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+// TestExportTraceProxy sends the spans through --proxy as the other outbound requests are
+func TestExportTraceProxy(t *testing.T) {
+	var got string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Method + " " + r.URL.String()
+	}))
+	defer proxy.Close()
+	c := testClient(t, "http://localhost:8080", "-j", "deploy", "--otel-endpoint", "http://collector.invalid:4318", "--proxy", proxy.URL)
+
+	if err := c.exportTrace(testNow.Add(-time.Second), checkers.Ok("No build that takes too long time exists"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "POST http://collector.invalid:4318/v1/traces"; got != want {
+		t.Errorf("the proxy got %q, want %q", got, want)
+	}
+}
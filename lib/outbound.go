@@ -0,0 +1,81 @@
+package checkjenkinsbuildtime
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// defaultOutboundTimeout bounds requests to services other than Jenkins when `--timeout` is not given,
+// so that a hung secret backend or webhook does not hang the check
+const defaultOutboundTimeout = 10 * time.Second
+
+func (c *Client) outboundTimeout() time.Duration {
+	if c.opts.Timeout > 0 {
+		return c.opts.Timeout.Duration()
+	}
+	return defaultOutboundTimeout
+}
+
+// newOutboundTransport honors the flags of proxies and TLS trust, leaving out those only meaningful
+// to Jenkins such as `--unix-socket` and the client certificate
+func (c *Client) newOutboundTransport() (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{InsecureSkipVerify: c.opts.Insecure}
+	switch {
+	case c.opts.Proxy != "":
+		u, err := url.Parse(c.opts.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(u)
+	case c.opts.NoProxy:
+		t.Proxy = nil
+	}
+	if c.opts.Socks5 != "" {
+		var auth *proxy.Auth
+		if c.opts.Socks5User != "" {
+			auth = &proxy.Auth{User: c.opts.Socks5User, Password: c.opts.Socks5Password}
+		}
+		d, err := proxy.SOCKS5("tcp", c.opts.Socks5, auth, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = nil
+		t.DialContext = d.(proxy.ContextDialer).DialContext
+	}
+	if c.opts.CAFile != "" {
+		pool, err := loadCAFile(c.opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	return t, nil
+}
+
+// outboundClient returns the client for services other than Jenkins, e.g. secret backends, webhooks and collectors,
+// bounded by `--timeout`. It is built once so that connections are reused by later checks.
+func (c *Client) outboundClient() *http.Client {
+	c.outboundOnce.Do(func() {
+		t, err := c.newOutboundTransport()
+		if err != nil {
+			// The same flags fail setting up the client of Jenkins with the reason
+			log.Printf("Failed to set up the HTTP client for other services than Jenkins: %s", err)
+			t = http.DefaultTransport.(*http.Transport).Clone()
+		}
+		c.outbound = &http.Client{Transport: t, Timeout: c.outboundTimeout()}
+	})
+	return c.outbound
+}
+
+// metadataClient returns the client for the metadata servers of clouds, which are link-local and never proxied
+func (c *Client) metadataClient() *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	return &http.Client{Transport: t, Timeout: c.outboundTimeout()}
+}
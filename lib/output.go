@@ -0,0 +1,227 @@
+package checkjenkinsbuildtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+// buildEvaluation is how a build compares with the thresholds
+type buildEvaluation struct {
+	Number         int     `json:"number"`
+	URL            string  `json:"url"`
+	Running        bool    `json:"running"`
+	Result         string  `json:"result,omitempty"`
+	Status         string  `json:"status"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// WarningSeconds and CriticalSeconds are null for thresholds disabled by `--no-warning` and `--no-critical`
+	WarningSeconds  *float64 `json:"warning_seconds"`
+	CriticalSeconds *float64 `json:"critical_seconds"`
+}
+
+func thresholdSeconds(d time.Duration) *float64 {
+	if d == NoThreshold {
+		return nil
+	}
+	s := d.Seconds()
+	return &s
+}
+
+// perfThreshold is the threshold in perfdata, left empty if disabled
+func perfThreshold(s *float64) string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.0f", *s)
+}
+
+// gaugeThreshold is the threshold as a gauge, +Inf if disabled
+func gaugeThreshold(s *float64) float64 {
+	if s == nil {
+		return math.Inf(1)
+	}
+	return *s
+}
+
+// evaluateBuilds compares the elapsed time of running builds and the duration of finished builds with the thresholds
+func (c *Client) evaluateBuilds(t target, bs []build) []buildEvaluation {
+	warning, critical := c.thresholdFuncs(t, bs)
+	ret := make([]buildEvaluation, 0, len(bs))
+	for _, b := range bs {
+		elapsed := b.executionTime()
+		if b.isUnfinished() {
+			elapsed = c.now().Sub(b.startedAt())
+		}
+		st := checkers.OK
+		switch {
+		case elapsed > critical(b):
+			st = checkers.CRITICAL
+		case elapsed > warning(b):
+			st = checkers.WARNING
+		}
+		result := ""
+		if b.Result != nil {
+			result = *b.Result
+		}
+		ret = append(ret, buildEvaluation{
+			Number:          b.Number,
+			URL:             c.buildURL(t, b),
+			Running:         b.isUnfinished(),
+			Result:          result,
+			Status:          st.String(),
+			ElapsedSeconds:  elapsed.Seconds(),
+			WarningSeconds:  thresholdSeconds(warning(b)),
+			CriticalSeconds: thresholdSeconds(critical(b)),
+		})
+	}
+	return ret
+}
+
+type jobOutput struct {
+	Job     string            `json:"job"`
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Builds  []buildEvaluation `json:"builds"`
+}
+
+type resultOutput struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Jobs    []jobOutput `json:"jobs"`
+}
+
+func newResultOutput(ckr *checkers.Checker, results []jobResult) resultOutput {
+	o := resultOutput{
+		Status:  ckr.Status.String(),
+		Message: ckr.Message,
+		Jobs:    make([]jobOutput, 0, len(results)),
+	}
+	for _, r := range results {
+		o.Jobs = append(o.Jobs, jobOutput{r.job, r.checker.Status.String(), r.checker.Message, r.evaluations})
+	}
+	return o
+}
+
+// longestRunning returns the running build which has been running longest among the jobs
+func longestRunning(results []jobResult) *buildEvaluation {
+	var longest *buildEvaluation
+	for _, r := range results {
+		for i, e := range r.evaluations {
+			if e.Running && (longest == nil || e.ElapsedSeconds > longest.ElapsedSeconds) {
+				longest = &r.evaluations[i]
+			}
+		}
+	}
+	return longest
+}
+
+func countRunning(results []jobResult) int {
+	n := 0
+	for _, r := range results {
+		for _, e := range r.evaluations {
+			if e.Running {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// nagiosLine formats the result as `STATUS - message | perfdata` for NRPE and Icinga
+func nagiosLine(ckr *checkers.Checker, results []jobResult) string {
+	perf := fmt.Sprintf("running=%d;;;0", countRunning(results))
+	if l := longestRunning(results); l != nil {
+		perf = fmt.Sprintf("longest_running=%.0fs;%s;%s;0 %s", l.ElapsedSeconds, perfThreshold(l.WarningSeconds), perfThreshold(l.CriticalSeconds), perf)
+	}
+	return fmt.Sprintf("%s - %s | %s", ckr.Status, ckr.Message, perf)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// statusValue is the status as the exit code of Nagios plugins
+func statusValue(st checkers.Status) int {
+	switch st {
+	case checkers.OK:
+		return 0
+	case checkers.WARNING:
+		return 1
+	case checkers.CRITICAL:
+		return 2
+	}
+	return 3
+}
+
+// prometheusMetrics formats the result in the exposition format for the textfile collector of node_exporter
+func prometheusMetrics(ckr *checkers.Checker, results []jobResult) []byte {
+	var b bytes.Buffer
+	// The status of the whole check is another metric, since summing the jobs of one metric would count it twice
+	fmt.Fprintln(&b, "# HELP jenkins_build_check_overall_status Status reported by the check (0: OK, 1: WARNING, 2: CRITICAL, 3: UNKNOWN)")
+	fmt.Fprintln(&b, "# TYPE jenkins_build_check_overall_status gauge")
+	fmt.Fprintf(&b, "jenkins_build_check_overall_status %d\n", statusValue(ckr.Status))
+	fmt.Fprintln(&b, "# HELP jenkins_build_check_status Status of the job (0: OK, 1: WARNING, 2: CRITICAL, 3: UNKNOWN)")
+	fmt.Fprintln(&b, "# TYPE jenkins_build_check_status gauge")
+	for _, r := range results {
+		fmt.Fprintf(&b, "jenkins_build_check_status{job=\"%s\"} %d\n", labelEscaper.Replace(r.job), statusValue(r.checker.Status))
+	}
+	gauges := []struct {
+		name  string
+		help  string
+		value func(buildEvaluation) float64
+	}{
+		{"jenkins_build_elapsed_seconds", "Elapsed time of running builds and duration of finished builds", func(e buildEvaluation) float64 { return e.ElapsedSeconds }},
+		{"jenkins_build_warning_seconds", "Warning threshold of the build", func(e buildEvaluation) float64 { return gaugeThreshold(e.WarningSeconds) }},
+		{"jenkins_build_critical_seconds", "Critical threshold of the build", func(e buildEvaluation) float64 { return gaugeThreshold(e.CriticalSeconds) }},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n", g.name, g.help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", g.name)
+		for _, r := range results {
+			for _, e := range r.evaluations {
+				fmt.Fprintf(&b, "%s{job=\"%s\",number=\"%d\",running=\"%t\"} %g\n", g.name, labelEscaper.Replace(r.job), e.Number, e.Running, g.value(e))
+			}
+		}
+	}
+	fmt.Fprintln(&b, "# HELP jenkins_build_result Result of finished builds, always 1")
+	fmt.Fprintln(&b, "# TYPE jenkins_build_result gauge")
+	for _, r := range results {
+		for _, e := range r.evaluations {
+			if !e.Running {
+				fmt.Fprintf(&b, "jenkins_build_result{job=\"%s\",number=\"%d\",result=\"%s\"} 1\n", labelEscaper.Replace(r.job), e.Number, e.Result)
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// printResult prints the result in the format given by `--output` and `--format`
+func (c *Client) printResult(ckr *checkers.Checker, results []jobResult) error {
+	if c.opts.Output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(newResultOutput(ckr, results))
+	}
+	line := ckr.String()
+	switch c.opts.Format {
+	case "nagios", "sensu":
+		// Sensu Go extracts metrics from the line with `output_metric_format: nagios_perfdata`
+		line = nagiosLine(ckr, results)
+	case "prometheus":
+		metrics := prometheusMetrics(ckr, results)
+		if c.opts.OutputFile == "" {
+			_, err := os.Stdout.Write(metrics)
+			return err
+		}
+		if err := writeFileAtomic(c.opts.OutputFile, metrics); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Println(line)
+	return err
+}
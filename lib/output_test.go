@@ -0,0 +1,29 @@
+package checkjenkinsbuildtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mackerelio/checkers"
+)
+
+// TestPrometheusMetricsSeries keeps every series of a metric with the same labels
+func TestPrometheusMetricsSeries(t *testing.T) {
+	results := []jobResult{
+		{job: "deploy", checker: checkers.Critical("Build id = 3 takes too long time")},
+		{job: "test", checker: checkers.Ok("No build that takes too long time exists")},
+	}
+	out := string(prometheusMetrics(checkers.Critical("Build id = 3 takes too long time"), results))
+	for _, want := range []string{
+		"jenkins_build_check_overall_status 2\n",
+		"jenkins_build_check_status{job=\"deploy\"} 2\n",
+		"jenkins_build_check_status{job=\"test\"} 0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "\njenkins_build_check_status ") {
+		t.Errorf("jenkins_build_check_status has a series without the job label:\n%s", out)
+	}
+}
@@ -0,0 +1,134 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+/*
+Builds waiting for executors are listed in the queue API.
+
+% curl -s "http://localhost:8080/queue/api/json?tree=items[id,inQueueSince,why,stuck,task[name,url]]" | jq .
+{
+  "items": [
+    {
+      "id": 42,
+      "inQueueSince": 1503146442652,
+      "stuck": false,
+      "why": "Waiting for next available executor on linux-large",
+      "task": {
+        "name": "sleep30",
+        "url": "http://localhost:8080/job/sleep30/"
+      }
+    }
+  ]
+}
+*/
+
+type queueItem struct {
+	ID           int      `json:"id"`
+	InQueueSince jsonTime `json:"inQueueSince"`
+	Why          string   `json:"why"`
+	Stuck        bool     `json:"stuck"`
+	Task         struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	} `json:"task"`
+}
+
+type queue struct {
+	Items []queueItem `json:"items"`
+}
+
+func (c *Client) fetchQueue(ctx context.Context) ([]queueItem, error) {
+	var q queue
+	url := c.baseURL() + "/queue/api/json?tree=items[id,inQueueSince,why,stuck,task[name,url]]"
+	if err := c.fetchJSON(ctx, url, c.defaultCredentials(), &q); err != nil {
+		return nil, err
+	}
+	for i := range q.Items {
+		q.Items[i].InQueueSince = q.Items[i].InQueueSince.inUnit(c.opts.TimestampUnit)
+	}
+	return q.Items, nil
+}
+
+// queueItemsOf returns items of the job at jobURL.
+// Task URLs are compared by their whole unescaped paths since Jenkins may know itself by another host name,
+// and the job of the same name in a folder is another job.
+func queueItemsOf(items []queueItem, jobURL string) []queueItem {
+	ret := make([]queueItem, 0)
+	want, ok := urlPath(jobURL)
+	if !ok {
+		return ret
+	}
+	for _, i := range items {
+		if p, ok := urlPath(i.Task.URL); ok && p == want {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// urlPath returns the unescaped path of the URL without the trailing slash
+func urlPath(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimRight(u.Path, "/"), true
+}
+
+// withQueueReason appends why the queue items of the job wait to the message, e.g. the label lacking executors.
+// The reason is only informative, so the message is left as it is when the queue cannot be fetched.
+func (c *Client) withQueueReason(ctx context.Context, t target, ckr *checkers.Checker) *checkers.Checker {
+	items, err := c.fetchQueue(ctx)
+	if err != nil {
+		return ckr
+	}
+	reasons := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, i := range queueItemsOf(items, c.jobURL(t.job, "")) {
+		if i.Why != "" && !seen[i.Why] {
+			seen[i.Why] = true
+			reasons = append(reasons, i.Why)
+		}
+	}
+	if len(reasons) == 0 {
+		return ckr
+	}
+	return checkers.NewChecker(ckr.Status, fmt.Sprintf("%s (queued: %s)", ckr.Message, strings.Join(reasons, "; ")))
+}
+
+func orDefault(d duration, def time.Duration) time.Duration {
+	if d > 0 {
+		return d.Duration()
+	}
+	return def
+}
+
+func (c *Client) checkQueue(ctx context.Context, t target) *checkers.Checker {
+	items, err := c.fetchQueue(ctx)
+	if err != nil {
+		return c.fetchErrorChecker(err)
+	}
+	warning := orDefault(c.opts.QueueWarning, t.warning)
+	critical := orDefault(c.opts.QueueCritical, t.critical)
+
+	var worst *checkers.Checker
+	for _, i := range queueItemsOf(items, c.jobURL(t.job, "")) {
+		waiting := c.now().Sub(i.InQueueSince.toTime())
+		msg := fmt.Sprintf("Queue item id = %d waits for %s: %s", i.ID, waiting.Truncate(time.Second), i.Why)
+		switch {
+		case waiting > critical:
+			worst = worse(worst, checkers.Critical(msg))
+		case waiting > warning:
+			worst = worse(worst, checkers.Warning(msg))
+		}
+	}
+	return worst
+}
@@ -0,0 +1,38 @@
+package checkjenkinsbuildtime
+
+import "testing"
+
+func TestQueueItemsOf(t *testing.T) {
+	item := func(id int, url string) queueItem {
+		var i queueItem
+		i.ID, i.Task.URL = id, url
+		return i
+	}
+	items := []queueItem{
+		item(1, "http://jenkins.internal:8080/job/deploy/"),
+		item(2, "http://jenkins.internal:8080/job/team/job/deploy/"),
+		item(3, "http://jenkins.internal:8080/job/my%20app/"),
+		item(4, "http://jenkins.internal:8080/job/predeploy/"),
+	}
+	tests := []struct {
+		jobURL string
+		want   []int
+	}{
+		{"http://localhost:8080/job/deploy", []int{1}},
+		{"http://localhost:8080/job/team/job/deploy", []int{2}},
+		{"http://localhost:8080/job/my%20app", []int{3}},
+		{"http://localhost:8080/job/other", nil},
+	}
+	for _, tt := range tests {
+		got := queueItemsOf(items, tt.jobURL)
+		if len(got) != len(tt.want) {
+			t.Errorf("queueItemsOf(%q) = %v, want ids %v", tt.jobURL, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].ID != tt.want[i] {
+				t.Errorf("queueItemsOf(%q) = %v, want ids %v", tt.jobURL, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package checkjenkinsbuildtime
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+// Checks below look at results of finished builds rather than how long builds take.
+
+func (b build) hasResult(result string) bool {
+	return b.Result != nil && *b.Result == result
+}
+
+func countResult(builds []build, result string) int {
+	n := 0
+	for _, b := range builds {
+		if b.hasResult(result) {
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Client) checkFailureCount(bs builds) *checkers.Checker {
+	n := countResult(bs.Builds, "FAILURE")
+	msg := fmt.Sprintf("%d of recent %d builds failed", n, len(bs.Builds))
+	if c.opts.FailureCritical > 0 && n >= c.opts.FailureCritical {
+		return checkers.Critical(msg)
+	}
+	if c.opts.FailureWarning > 0 && n >= c.opts.FailureWarning {
+		return checkers.Warning(msg)
+	}
+	return nil
+}
+
+// failureStreak returns how many of the latest completed builds failed in a row
+func failureStreak(builds []build) int {
+	n := 0
+	for _, b := range builds {
+		if b.isUnfinished() {
+			continue
+		}
+		if !b.hasResult("FAILURE") {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+func (c *Client) checkConsecutiveFailures(bs builds) *checkers.Checker {
+	if c.opts.ConsecutiveFailuresCritical <= 0 {
+		return nil
+	}
+	if n := failureStreak(bs.Builds); n >= c.opts.ConsecutiveFailuresCritical {
+		return checkers.Critical(fmt.Sprintf("Latest %d builds failed in a row", n))
+	}
+	return nil
+}
+
+func (c *Client) checkSuccessRate(bs builds) *checkers.Checker {
+	if c.opts.SuccessRateWarning <= 0 && c.opts.SuccessRateCritical <= 0 {
+		return nil
+	}
+	completed := len(bs.Builds) - countUnfinished(bs.Builds)
+	if completed == 0 {
+		return nil
+	}
+	rate := float64(countResult(bs.Builds, "SUCCESS")) / float64(completed) * 100
+	msg := fmt.Sprintf("Success rate of recent %d builds is %.1f%%", completed, rate)
+	if rate < c.opts.SuccessRateCritical {
+		return checkers.Critical(msg)
+	}
+	if rate < c.opts.SuccessRateWarning {
+		return checkers.Warning(msg)
+	}
+	return nil
+}
+
+// checkLastSuccess alerts when the last successful build is older than the thresholds, or there is none
+func (c *Client) checkLastSuccess(bs builds) *checkers.Checker {
+	if c.opts.LastSuccessWarning <= 0 && c.opts.LastSuccessCritical <= 0 {
+		return nil
+	}
+	msg := "No build has succeeded"
+	var age time.Duration = math.MaxInt64
+	if b := bs.LastSuccessfulBuild; b != nil {
+		age = c.now().Sub(b.Timestamp.toTime().Add(b.duration()))
+		msg = fmt.Sprintf("Last successful build id = %d completed %s ago", b.Number, age.Truncate(time.Second))
+	}
+	if c.opts.LastSuccessCritical > 0 && age > c.opts.LastSuccessCritical.Duration() {
+		return checkers.Critical(msg)
+	}
+	if c.opts.LastSuccessWarning > 0 && age > c.opts.LastSuccessWarning.Duration() {
+		return checkers.Warning(msg)
+	}
+	return nil
+}
+
+// checkNoBuildWithin alerts when the newest build started before the thresholds, catching jobs which stopped running at all
+func (c *Client) checkNoBuildWithin(bs builds) *checkers.Checker {
+	if c.opts.NoBuildWithinWarning <= 0 && c.opts.NoBuildWithinCritical <= 0 {
+		return nil
+	}
+	msg := "No build exists"
+	var age time.Duration = math.MaxInt64
+	if len(bs.Builds) > 0 {
+		b := bs.Builds[0]
+		age = c.now().Sub(b.Timestamp.toTime())
+		msg = fmt.Sprintf("Newest build id = %d started %s ago", b.Number, age.Truncate(time.Second))
+	}
+	if c.opts.NoBuildWithinCritical > 0 && age > c.opts.NoBuildWithinCritical.Duration() {
+		return checkers.Critical(msg)
+	}
+	if c.opts.NoBuildWithinWarning > 0 && age > c.opts.NoBuildWithinWarning.Duration() {
+		return checkers.Warning(msg)
+	}
+	return nil
+}
+
+// latestCompleted returns the newest finished build with the result, or nil if there is none
+func latestCompleted(builds []build) *build {
+	for i, b := range builds {
+		if !b.isUnfinished() && b.Result != nil {
+			return &builds[i]
+		}
+	}
+	return nil
+}
+
+// checkLatestResult maps UNSTABLE and ABORTED of the latest completed build to the status given by flags
+func (c *Client) checkLatestResult(bs builds) *checkers.Checker {
+	b := latestCompleted(bs.Builds)
+	if b == nil {
+		return nil
+	}
+	var st checkers.Status
+	switch *b.Result {
+	case "UNSTABLE":
+		st = parseStatus(c.opts.UnstableAs)
+	case "ABORTED":
+		st = parseStatus(c.opts.AbortedAs)
+	default:
+		return nil
+	}
+	if st == checkers.OK {
+		return nil
+	}
+	return checkers.NewChecker(st, fmt.Sprintf("Latest build id = %d is %s", b.Number, *b.Result))
+}
+
+// checkResults returns the alerts of the result checks, or nil if none of them alerts
+func (c *Client) checkResults(bs builds) *checkers.Checker {
+	alerts := make([]*checkers.Checker, 0)
+	for _, check := range []func(builds) *checkers.Checker{
+		c.checkFailureCount,
+		c.checkConsecutiveFailures,
+		c.checkSuccessRate,
+		c.checkLastSuccess,
+		c.checkNoBuildWithin,
+		c.checkLatestResult,
+	} {
+		alerts = append(alerts, check(bs))
+	}
+	return combine(alerts)
+}
@@ -0,0 +1,61 @@
+package checkjenkinsbuildtime
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+// TestLastSuccessSingleBuild checks the last successful build of the job when only one build is fetched
+func TestLastSuccessSingleBuild(t *testing.T) {
+	build, _ := json.Marshal(stubBuild{number: 7, ago: 2 * time.Hour, duration: time.Minute, result: "FAILURE"}.json())
+	succeeded, _ := json.Marshal(map[string]interface{}{"lastSuccessfulBuild": stubBuild{number: 5, ago: 3 * time.Hour, duration: time.Minute, result: "SUCCESS"}.json()})
+	tests := []struct {
+		name string
+		mode []string
+		job  string
+		want checkers.Status
+	}{
+		{"build number", []string{"--build-number", "7"}, string(succeeded), checkers.OK},
+		{"build number without success", []string{"--build-number", "7"}, `{"lastSuccessfulBuild": null}`, checkers.CRITICAL},
+		{"last build only", []string{"--last-build-only"}, string(succeeded), checkers.OK},
+		{"last build only without success", []string{"--last-build-only"}, `{"lastSuccessfulBuild": null}`, checkers.CRITICAL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := stubJenkins(t, map[string]string{
+				"/job/deploy/7/":         string(build),
+				"/job/deploy/lastBuild/": string(build),
+				"/job/deploy/api/json":   tt.job,
+			})
+			ckr := testRun(t, srv.URL, append([]string{"-j", "deploy", "--last-success-critical", "24h"}, tt.mode...)...)
+			if ckr.Status != tt.want {
+				t.Errorf("status = %s, want %s: %s", ckr.Status, tt.want, ckr.Message)
+			}
+		})
+	}
+}
+
+// TestEveryAlertIsReported keeps the message of every check that alerts, not only the worst one
+func TestEveryAlertIsReported(t *testing.T) {
+	srv := stubJenkins(t, map[string]string{
+		"/job/deploy/": buildsJSON(
+			stubBuild{number: 3, ago: 10 * time.Minute},
+			stubBuild{number: 2, ago: time.Hour, duration: time.Minute, result: "FAILURE"},
+			stubBuild{number: 1, ago: 2 * time.Hour, duration: time.Minute, result: "FAILURE"},
+		),
+		"/job/deploy/lastCompletedBuild/testReport/": `{"failCount": 3, "skipCount": 2, "passCount": 5}`,
+	})
+	ckr := testRun(t, srv.URL, "-j", "deploy", "-w", "300", "-c", "3600", "--failure-warning", "2", "--test-fail-critical", "1", "--test-skip-warning", "1")
+	if ckr.Status != checkers.CRITICAL {
+		t.Errorf("status = %s, want %s: %s", ckr.Status, checkers.CRITICAL, ckr.Message)
+	}
+	for _, want := range []string{"10m0s > 5m0s", "2 of recent 3 builds failed", "3 of 10 tests failed", "2 of 10 tests were skipped"} {
+		if !strings.Contains(ckr.Message, want) {
+			t.Errorf("message = %q, want %q", ckr.Message, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// The `builds` element is limited to the recent 100 builds; `allBuilds` is not,
+// but fetching it at once is heavy for jobs with a long history.
+// We fetch it in pages with the `{M,N}` range selector instead.
+
+type allBuilds struct {
+	AllBuilds []build `json:"allBuilds"`
+}
+
+func (c *Client) fetchBuildsPage(ctx context.Context, t target, from, to int) ([]build, error) {
+	var page allBuilds
+	path := fmt.Sprintf("/api/json?tree=allBuilds[%s]{%d,%d}", c.buildTree(t), from, to)
+	if err := c.fetchJobJSON(ctx, t, path, &page); err != nil {
+		return nil, err
+	}
+	if c.opts.StrictSchema && page.AllBuilds == nil {
+		return nil, fmt.Errorf("the response of %s does not contain allBuilds", c.jobURL(t.job, path))
+	}
+	return page.AllBuilds, nil
+}
+
+type pageResult struct {
+	builds []build
+	err    error
+}
+
+// scanAllBuilds fetches `concurrency` pages at a time until a short page shows the end of the history,
+// or `limit` builds are fetched if it is positive.
+// Builds may shift between pages while builds are being started, so the result is deduplicated by build number
+// and sorted from newest to oldest like the `builds` element.
+func (c *Client) scanAllBuilds(ctx context.Context, t target, pageSize, concurrency, limit int) ([]build, error) {
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	seen := make(map[int]build)
+	for start := 0; limit <= 0 || start < limit; start += pageSize * concurrency {
+		results := make([]pageResult, concurrency)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			from := start + i*pageSize
+			to := from + pageSize
+			if limit > 0 && to > limit {
+				to = limit
+			}
+			if from >= to {
+				break
+			}
+			wg.Add(1)
+			go func(i, from, to int) {
+				defer wg.Done()
+				bs, err := c.fetchBuildsPage(ctx, t, from, to)
+				results[i] = pageResult{bs, err}
+			}(i, from, to)
+		}
+		wg.Wait()
+
+		finished := false
+		for _, r := range results {
+			if r.err != nil {
+				return nil, r.err
+			}
+			for _, b := range r.builds {
+				seen[b.Number] = b
+			}
+			if len(r.builds) < pageSize {
+				finished = true
+			}
+		}
+		if finished {
+			break
+		}
+	}
+
+	ret := make([]build, 0, len(seen))
+	for _, b := range seen {
+		ret = append(ret, b)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Number > ret[j].Number })
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
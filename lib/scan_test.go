@@ -0,0 +1,107 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var pageRange = regexp.MustCompile(`\{(\d+),(\d+)\}$`)
+
+// TestScanAllBuilds fetches pages of 250 builds concurrently, shifted by a build started meanwhile
+func TestScanAllBuilds(t *testing.T) {
+	const total = 250
+	var inFlight, maxInFlight int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			m := atomic.LoadInt64(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt64(&maxInFlight, m, n) {
+				break
+			}
+		}
+		// Concurrent requests overlap while one waits
+		time.Sleep(50 * time.Millisecond)
+
+		m := pageRange.FindStringSubmatch(r.URL.Query().Get("tree"))
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+		from, _ := strconv.Atoi(m[1])
+		to, _ := strconv.Atoi(m[2])
+		if from >= 100 {
+			// A new build started after the first page shifted the rest of the history by one,
+			// repeating the last build of the first page
+			from--
+			to--
+		}
+		builds := make([]interface{}, 0)
+		for i := from; i < to && i < total; i++ {
+			builds = append(builds, stubBuild{number: total - i, ago: time.Duration(i+1) * time.Hour, duration: time.Minute, result: "SUCCESS"}.json())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"allBuilds": builds})
+	}))
+	defer srv.Close()
+	c := testClient(t, srv.URL, "-j", "deploy", "--scan-all")
+	if err := c.setupClient(); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := c.scanAllBuilds(context.Background(), c.newTarget("deploy", time.Minute, 5*time.Minute), 100, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bs) != total {
+		t.Fatalf("got %d builds, want %d", len(bs), total)
+	}
+	for i, b := range bs {
+		if b.Number != total-i {
+			t.Fatalf("build %d is id = %d, want %d from newest to oldest", i, b.Number, total-i)
+		}
+	}
+	if maxInFlight < 2 {
+		t.Errorf("pages were fetched one at a time")
+	}
+}
+
+// TestScanAllBuildsLimit stops at the limit even if pages continue
+func TestScanAllBuildsLimit(t *testing.T) {
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		m := pageRange.FindStringSubmatch(r.URL.Query().Get("tree"))
+		from, _ := strconv.Atoi(m[1])
+		to, _ := strconv.Atoi(m[2])
+		builds := make([]interface{}, 0)
+		for i := from; i < to; i++ {
+			builds = append(builds, stubBuild{number: 1000 - i, ago: time.Hour, duration: time.Minute, result: "SUCCESS"}.json())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"allBuilds": builds})
+	}))
+	defer srv.Close()
+	c := testClient(t, srv.URL, "-j", "deploy", "--scan-all")
+	if err := c.setupClient(); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := c.scanAllBuilds(context.Background(), c.newTarget("deploy", time.Minute, 5*time.Minute), 10, 2, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bs) != 25 || bs[0].Number != 1000 || bs[24].Number != 976 {
+		t.Errorf("got %d builds from id = %d, want 25 builds from 1000 to 976", len(bs), bs[0].Number)
+	}
+	if requests != 3 {
+		t.Errorf("fetched %d pages, want 3", requests)
+	}
+}
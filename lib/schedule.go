@@ -0,0 +1,139 @@
+package checkjenkinsbuildtime
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// window is a weekly time range like `Sat 02:00-06:00` or `Mon-Fri 22:00-06:00`.
+// A range over midnight belongs to the day it starts, and days are optional meaning every day.
+type window struct {
+	days  [7]bool
+	start int
+	end   int
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	from, to := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		from, to = s[:i], s[i+1:]
+	}
+	f, ok := weekdays[strings.ToLower(from)]
+	if !ok {
+		return days, fmt.Errorf("invalid day %q", from)
+	}
+	t, ok := weekdays[strings.ToLower(to)]
+	if !ok {
+		return days, fmt.Errorf("invalid day %q", to)
+	}
+	for d := f; ; d = (d + 1) % 7 {
+		days[d] = true
+		if d == t {
+			break
+		}
+	}
+	return days, nil
+}
+
+func parseWindow(spec string) (window, error) {
+	var w window
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+		for i := range w.days {
+			w.days[i] = true
+		}
+	case 2:
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return w, err
+		}
+		w.days = days
+	default:
+		return w, fmt.Errorf("invalid window %q", spec)
+	}
+	r := strings.SplitN(fields[len(fields)-1], "-", 2)
+	if len(r) != 2 {
+		return w, fmt.Errorf("invalid window %q", spec)
+	}
+	var err error
+	if w.start, err = parseClock(r[0]); err != nil {
+		return w, err
+	}
+	if w.end, err = parseClock(r[1]); err != nil {
+		return w, err
+	}
+	return w, nil
+}
+
+func (w window) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	d := t.Weekday()
+	if w.start <= w.end {
+		return w.days[d] && w.start <= m && m < w.end
+	}
+	return (w.days[d] && m >= w.start) || (w.days[(d+6)%7] && m < w.end)
+}
+
+// location returns the timezone windows are given in, the local one by default
+func (c *Client) location() (*time.Location, error) {
+	if c.opts.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.opts.Timezone)
+}
+
+// activeWindow returns the index of the first window containing now, or -1
+func (c *Client) activeWindow(specs []string, now time.Time) (int, error) {
+	loc, err := c.location()
+	if err != nil {
+		return -1, err
+	}
+	for i, s := range specs {
+		w, err := parseWindow(s)
+		if err != nil {
+			return -1, err
+		}
+		if w.contains(now.In(loc)) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// mute reports a warning or a critical as OK in a maintenance window given by `--mute-window`
+func (c *Client) mute(ckr *checkers.Checker) *checkers.Checker {
+	if len(c.opts.MuteWindows) == 0 {
+		return ckr
+	}
+	i, err := c.activeWindow(c.opts.MuteWindows, c.now())
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Invalid mute window: %s", err))
+	}
+	if i < 0 || (ckr.Status != checkers.WARNING && ckr.Status != checkers.CRITICAL) {
+		return ckr
+	}
+	return checkers.Ok(fmt.Sprintf("%s (muted %s in maintenance window %s)", ckr.Message, ckr.Status, c.opts.MuteWindows[i]))
+}
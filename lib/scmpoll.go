@@ -0,0 +1,130 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+/*
+The log of the last SCM polling is kept as plain text, with the start time formatted
+in the locale and the time zone of Jenkins.
+
+% curl -s "http://localhost:8080/job/build/scmPollLog/pollingLog"
+Started on Oct 14, 2026, 6:00:02 AM
+Polling SCM changes on built-in
+Using strategy: Default
+[poll] Last Built Revision: Revision 1a2b3c (refs/remotes/origin/main)
+Done. Took 0.42 sec
+No changes
+*/
+
+// pollingLayouts are the start times of the polling log by the locales of Java, en_US before and after CLDR and ja_JP
+var pollingLayouts = []string{
+	"Jan 2, 2006, 3:04:05 PM",
+	"Jan 2, 2006 3:04:05 PM",
+	"2006/01/02 15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+type pollingLog struct {
+	started time.Time
+	done    bool
+	// failure is the first error line, empty if the polling succeeded
+	failure string
+}
+
+// parsePollingLog reads the start time and the outcome of the polling from its log
+func parsePollingLog(s string, loc *time.Location) (pollingLog, error) {
+	var l pollingLog
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	first := strings.TrimSpace(strings.ReplaceAll(lines[0], "\u202f", " "))
+	if !strings.HasPrefix(first, "Started on ") {
+		return l, fmt.Errorf("unexpected polling log: %q", first)
+	}
+	at := strings.TrimPrefix(first, "Started on ")
+	for _, layout := range pollingLayouts {
+		if t, err := time.ParseInLocation(layout, at, loc); err == nil {
+			l.started = t
+			break
+		}
+	}
+	if l.started.IsZero() {
+		return l, fmt.Errorf("unknown time format of the polling log: %q", at)
+	}
+	for _, line := range lines[1:] {
+		switch {
+		case strings.HasPrefix(line, "Done. Took"):
+			l.done = true
+		case l.failure == "" && (strings.HasPrefix(line, "ERROR:") || strings.HasPrefix(line, "FATAL:")):
+			l.failure = strings.TrimSpace(line)
+		}
+	}
+	return l, nil
+}
+
+func (c *Client) jenkinsLocation() (*time.Location, error) {
+	if c.opts.JenkinsTimezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.opts.JenkinsTimezone)
+}
+
+func (c *Client) fetchPollingLog(ctx context.Context, t target) (string, error) {
+	resp, err := c.fetch(ctx, c.jobURL(t.job, "/scmPollLog/pollingLog"), t.cred)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &httpStatusError{resp.StatusCode, resp.Status}
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	return string(b), err
+}
+
+// checkPolling alerts when the SCM polling of the job has not run, or has not succeeded,
+// within `--scm-poll-warning` and `--scm-poll-critical`, e.g. by broken credentials
+func (c *Client) checkPolling(ctx context.Context, t target) *checkers.Checker {
+	s, err := c.fetchPollingLog(ctx, t)
+	if err != nil {
+		if e, ok := err.(*httpStatusError); ok && e.code == http.StatusNotFound {
+			return checkers.Unknown("The job has no SCM polling log, polling is not configured or has never run")
+		}
+		return c.fetchErrorChecker(err)
+	}
+	loc, err := c.jenkinsLocation()
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Invalid time zone of Jenkins: %s", err))
+	}
+	l, err := parsePollingLog(s, loc)
+	if err != nil {
+		return checkers.Unknown(fmt.Sprintf("Failed to read the SCM polling log: %s", err))
+	}
+	url := c.jobURL(t.job, "/scmPollLog/")
+	age := c.now().Sub(l.started).Round(time.Second)
+	msg := fmt.Sprintf("SCM polling last ran %s ago", age)
+	switch {
+	case l.failure != "":
+		// Since the last success is unknown, a failed polling alerts at the most severe threshold given
+		msg = fmt.Sprintf("SCM polling %s ago failed: %s", age, l.failure)
+		if c.opts.SCMPollCritical > 0 {
+			return checkers.Critical(msg + " " + url)
+		}
+		return checkers.Warning(msg + " " + url)
+	case !l.done:
+		msg = fmt.Sprintf("SCM polling has been running for %s", age)
+	}
+	switch {
+	case c.opts.SCMPollCritical > 0 && age > c.opts.SCMPollCritical.Duration():
+		return checkers.Critical(msg + " " + url)
+	case c.opts.SCMPollWarning > 0 && age > c.opts.SCMPollWarning.Duration():
+		return checkers.Warning(msg + " " + url)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+)
+
+/*
+The API token can be read from HashiCorp Vault by `--vault-path` or from AWS Secrets Manager by `--aws-secret-id`.
+The secret is a JSON object holding the token (and optionally the user) under the keys given by
+`--secret-token-key` and `--secret-user-key`. A secret of Secrets Manager may also be the token itself.
+
+{
+  "user": "monitor",
+  "api_token": "11d3a7b1f2..."
+}
+
+With `--secret-cache-file`, the secret is kept in the file readable only by the owner for `--secret-cache-ttl`,
+so that checks every minute do not query the backend every time.
+*/
+
+// secretCache is the content of `--secret-cache-file`
+type secretCache struct {
+	// Source tells which secret is cached, so that changing the flags never uses a stale one
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetched_at"`
+	User      string    `json:"user,omitempty"`
+	Token     string    `json:"token"`
+}
+
+// secretSource identifies the secret given by flags
+func (c *Client) secretSource() string {
+	if c.opts.VaultPath != "" {
+		return "vault:" + c.opts.VaultPath
+	}
+	return "aws:" + c.opts.AWSSecretID
+}
+
+// secretFields picks the user and the token out of the secret
+func (c *Client) secretFields(data map[string]interface{}) (user, token string, err error) {
+	token, _ = data[c.opts.SecretTokenKey].(string)
+	if token == "" {
+		return "", "", fmt.Errorf("the secret has no %s", c.opts.SecretTokenKey)
+	}
+	user, _ = data[c.opts.SecretUserKey].(string)
+	return user, token, nil
+}
+
+func (c *Client) fetchSecret(ctx context.Context) (user, token string, err error) {
+	if c.opts.VaultPath != "" {
+		data, err := fetchVaultSecret(ctx, c.outboundClient(), c.opts.VaultPath)
+		if err != nil {
+			return "", "", err
+		}
+		return c.secretFields(data)
+	}
+	s, err := c.fetchAWSSecret(ctx, c.opts.AWSSecretID)
+	if err != nil {
+		return "", "", err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &data); err != nil {
+		// The secret is the token itself
+		return "", strings.TrimSpace(s), nil
+	}
+	return c.secretFields(data)
+}
+
+func (c *Client) cachedSecret() (secretCache, bool) {
+	var sc secretCache
+	if c.opts.SecretCacheFile == "" {
+		return sc, false
+	}
+	b, err := ioutil.ReadFile(c.opts.SecretCacheFile)
+	if err != nil || json.Unmarshal(b, &sc) != nil {
+		return sc, false
+	}
+	if sc.Source != c.secretSource() || c.now().Sub(sc.FetchedAt) > c.opts.SecretCacheTTL.Duration() {
+		return sc, false
+	}
+	return sc, true
+}
+
+// secretCredentials reads the credentials from the secret backend, or from `--secret-cache-file` while it is fresh
+func (c *Client) secretCredentials(ctx context.Context) (user, token string, err error) {
+	sc, ok := c.cachedSecret()
+	if !ok {
+		user, token, err := c.fetchSecret(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		sc = secretCache{c.secretSource(), c.now(), user, token}
+		if c.opts.SecretCacheFile != "" {
+			b, err := json.Marshal(sc)
+			if err != nil {
+				return "", "", err
+			}
+			// writeFileAtomic creates the file readable only by the owner
+			if err := writeFileAtomic(c.opts.SecretCacheFile, b); err != nil {
+				log.Printf("Failed to write the secret cache: %s", err)
+			}
+		}
+	}
+	return sc.User, sc.Token, nil
+}
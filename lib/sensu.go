@@ -0,0 +1,73 @@
+package checkjenkinsbuildtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mackerelio/checkers"
+)
+
+// sensuCheckName is the name of the check in events sent to the Sensu Go agent
+const sensuCheckName = "jenkins-build-time"
+
+type sensuEvent struct {
+	Check sensuCheck `json:"check"`
+}
+
+type sensuCheck struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	Status int    `json:"status"`
+	Output string `json:"output"`
+}
+
+// sensuAnnotations returns annotations given by `--sensu-annotation`,
+// with the URLs of the builds over the thresholds for handlers to link to
+func (c *Client) sensuAnnotations(results []jobResult) map[string]string {
+	a := make(map[string]string)
+	for _, r := range results {
+		urls := make([]string, 0, len(r.builds))
+		for _, e := range r.evaluations {
+			for _, n := range r.builds {
+				if e.Number == n {
+					urls = append(urls, e.URL)
+				}
+			}
+		}
+		if len(urls) > 0 {
+			a["jenkins/"+r.job] = strings.Join(urls, " ")
+		}
+	}
+	for _, s := range c.opts.SensuAnnotations {
+		if k, v, ok := splitParam(s); ok {
+			a[k] = v
+		}
+	}
+	return a
+}
+
+// sendSensuEvent posts the result to the events API of the Sensu Go agent, which passes it to the backend with the annotations
+func (c *Client) sendSensuEvent(ckr *checkers.Checker, results []jobResult) error {
+	var e sensuEvent
+	e.Check.Metadata.Name = sensuCheckName
+	e.Check.Metadata.Annotations = c.sensuAnnotations(results)
+	e.Check.Status = statusValue(ckr.Status)
+	e.Check.Output = ckr.Message
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := c.outboundClient().Post(strings.TrimRight(c.opts.SensuAgentAPI, "/")+"/events", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
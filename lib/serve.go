@@ -0,0 +1,121 @@
+package checkjenkinsbuildtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+// snapshot is the result of a check kept for requests while polling with `--poll-interval`
+type snapshot struct {
+	checker *checkers.Checker
+	results []jobResult
+	queue   []queueItem
+}
+
+func (c *Client) takeSnapshot(ctx context.Context) *snapshot {
+	// Requests without --poll-interval are checked one at a time,
+	// since a run keeps its state, e.g. ignoreThresholds and lastStatus, in the client
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	ckr, results := c.run(ctx)
+	ckr.Name = c.opts.checkName()
+	c.notifyChange(ckr)
+	s := &snapshot{checker: ckr, results: results}
+	// The queue is only for metrics, failing to fetch it leaves them out
+	if len(results) > 0 {
+		s.queue, _ = c.fetchQueue(ctx)
+	}
+	return s
+}
+
+// currentSnapshot returns the latest polled snapshot, or takes one if not polling
+func (c *Client) currentSnapshot(ctx context.Context) *snapshot {
+	c.latestMu.RLock()
+	s := c.latest
+	c.latestMu.RUnlock()
+	if s != nil {
+		return s
+	}
+	return c.takeSnapshot(ctx)
+}
+
+func (c *Client) poll(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		s := c.takeSnapshot(ctx)
+		c.latestMu.Lock()
+		c.latest = s
+		c.latestMu.Unlock()
+	}
+}
+
+// healthz answers the check as a readiness probe.
+// WARNING is still considered ready, CRITICAL and UNKNOWN are not.
+func (c *Client) healthz(w http.ResponseWriter, r *http.Request) {
+	ckr := c.currentSnapshot(r.Context()).checker
+	switch ckr.Status {
+	case checkers.OK, checkers.WARNING:
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, ckr.String())
+}
+
+// queueMetrics adds the number of queue items and the longest wait of each job.
+// The queue is the one of the Jenkins of the flags, where jobs of the other instances are never found.
+func (c *Client) queueMetrics(b *bytes.Buffer, s *snapshot) {
+	fmt.Fprintln(b, "# HELP jenkins_queue_items Number of queue items of the job")
+	fmt.Fprintln(b, "# TYPE jenkins_queue_items gauge")
+	for _, r := range s.results {
+		fmt.Fprintf(b, "jenkins_queue_items{job=\"%s\"} %d\n", labelEscaper.Replace(r.job), len(queueItemsOf(s.queue, c.jobURL(r.job, ""))))
+	}
+	fmt.Fprintln(b, "# HELP jenkins_queue_waiting_seconds Longest wait of queue items of the job")
+	fmt.Fprintln(b, "# TYPE jenkins_queue_waiting_seconds gauge")
+	for _, r := range s.results {
+		var longest time.Duration
+		for _, i := range queueItemsOf(s.queue, c.jobURL(r.job, "")) {
+			if w := c.now().Sub(i.InQueueSince.toTime()); w > longest {
+				longest = w
+			}
+		}
+		fmt.Fprintf(b, "jenkins_queue_waiting_seconds{job=\"%s\"} %g\n", labelEscaper.Replace(r.job), longest.Seconds())
+	}
+}
+
+func (c *Client) metrics(w http.ResponseWriter, r *http.Request) {
+	s := c.currentSnapshot(r.Context())
+	b := bytes.NewBuffer(prometheusMetrics(s.checker, s.results))
+	c.queueMetrics(b, s)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(b.Bytes())
+}
+
+func (c *Client) serve(ctx context.Context, addr string) error {
+	if c.opts.PollInterval > 0 {
+		// The first snapshot is taken before serving so that requests never run the check by themselves
+		c.latest = c.takeSnapshot(ctx)
+		go c.poll(ctx, c.opts.PollInterval.Duration())
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", c.healthz)
+	mux.HandleFunc("/metrics", c.metrics)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package checkjenkinsbuildtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestHealthzParallel runs checks of concurrent requests without --poll-interval, meant to be run with -race
+func TestHealthzParallel(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer webhook.Close()
+	srv := stubJenkins(t, map[string]string{
+		"/api/json":    `{"quietingDown": true}`,
+		"/job/deploy/": buildsJSON(stubBuild{number: 2, ago: 10 * time.Minute}),
+	})
+	c := testClient(t, srv.URL, "-j", "deploy", "--quiet-down", "ignore-thresholds", "--notify-webhook", webhook.URL, "--serve", ":0")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			c.healthz(rec, httptest.NewRequest("GET", "/healthz", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHealthz(t *testing.T) {
+	tests := []struct {
+		name   string
+		builds []stubBuild
+		want   int
+		status string
+	}{
+		{"ok", []stubBuild{{number: 1, ago: time.Hour, duration: time.Minute, result: "SUCCESS"}}, http.StatusOK, "OK"},
+		{"warning is ready", []stubBuild{{number: 2, ago: 2 * time.Minute}}, http.StatusOK, "WARNING"},
+		{"critical", []stubBuild{{number: 3, ago: 10 * time.Minute}}, http.StatusServiceUnavailable, "CRITICAL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := stubJenkins(t, map[string]string{"/job/deploy/": buildsJSON(tt.builds...)})
+			c := testClient(t, srv.URL, "-j", "deploy", "-w", "60", "-c", "300", "--serve", ":0")
+			rec := httptest.NewRecorder()
+			c.healthz(rec, httptest.NewRequest("GET", "/healthz", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.status) {
+				t.Errorf("body = %q, want %s with the message", rec.Body, tt.status)
+			}
+		})
+	}
+}
+
+// TestHealthzUnreachable answers 503 while Jenkins cannot be checked
+func TestHealthzUnreachable(t *testing.T) {
+	srv := stubJenkins(t, map[string]string{})
+	c := testClient(t, srv.URL, "-j", "deploy", "--serve", ":0")
+	rec := httptest.NewRecorder()
+	c.healthz(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,90 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+/*
+The progressive console endpoint tells the size of the console log so far in X-Text-Size,
+returning the log after the offset given by `start`. A HEAD request tells the size without the log.
+
+% curl -sI "http://localhost:8080/job/deploy/57/logText/progressiveText?start=0" | grep X-Text-Size
+X-Text-Size: 18234
+*/
+
+// consoleSize returns the size of the console log of the build.
+// When HEAD is not allowed, e.g. by a proxy, the log is read after start, which is the size known so far.
+func (c *Client) consoleSize(ctx context.Context, t target, number int, start int64) (int64, error) {
+	url := c.jobURL(t.job, fmt.Sprintf("/%d/logText/progressiveText?start=%d", number, start))
+	resp, err := c.send(ctx, "HEAD", url, t.cred)
+	if err == nil && resp.StatusCode == http.StatusMethodNotAllowed {
+		resp.Body.Close()
+		resp, err = c.fetch(ctx, url, t.cred)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, &httpStatusError{resp.StatusCode, resp.Status}
+	}
+	size, err := strconv.ParseInt(resp.Header.Get("X-Text-Size"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid X-Text-Size of the console log: %q", resp.Header.Get("X-Text-Size"))
+	}
+	return size, nil
+}
+
+// checkStall goes critical on running builds over the warning threshold whose console log does not grow
+// in `--stall-window`, telling hung builds from those taking long but progressing
+func (c *Client) checkStall(ctx context.Context, t target, bs []build) *checkers.Checker {
+	warning, critical := c.thresholdFuncs(t, bs)
+	if t.warning == NoThreshold {
+		// Builds are still told hung beyond the critical threshold when only it is enforced
+		warning = critical
+	}
+	sizes := make(map[int]int64)
+	for _, b := range bs {
+		if !b.isUnfinished() || c.now().Sub(b.startedAt()) <= warning(b) {
+			continue
+		}
+		size, err := c.consoleSize(ctx, t, b.Number, 0)
+		if err != nil {
+			return c.fetchErrorChecker(err)
+		}
+		sizes[b.Number] = size
+	}
+	if len(sizes) == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-time.After(c.opts.StallWindow.Duration()):
+	}
+	for _, b := range bs {
+		prev, ok := sizes[b.Number]
+		if !ok {
+			continue
+		}
+		size, err := c.consoleSize(ctx, t, b.Number, prev)
+		if err != nil {
+			return c.fetchErrorChecker(err)
+		}
+		if size <= prev {
+			return checkers.Critical(fmt.Sprintf("Build id = %d seems hung, its console log did not grow in %s %s", b.Number, c.opts.StallWindow.Duration(), c.buildURL(t, b)))
+		}
+	}
+	return nil
+}
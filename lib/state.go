@@ -0,0 +1,137 @@
+package checkjenkinsbuildtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mackerelio/checkers"
+)
+
+/*
+The state file given by `--state-file` records the last status and the last alert of each job.
+Alerts on builds over the thresholds are told apart by the build numbers since their messages include elapsed times,
+and other alerts by their messages.
+
+{
+  "status": "WARNING",
+  "alerts": {
+    "deploy": {
+      "status": "WARNING",
+      "message": "Build id = 57 takes too long time (6m2s > 5m0s) http://localhost:8080/job/deploy/57/",
+      "builds": [57]
+    }
+  }
+}
+*/
+
+type state struct {
+	// Status is the last status reported, to notify changes by `--notify-webhook`
+	Status string           `json:"status,omitempty"`
+	Alerts map[string]alert `json:"alerts"`
+}
+
+type alert struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Builds  []int  `json:"builds,omitempty"`
+}
+
+func (a alert) isSame(b alert) bool {
+	if a.Status != b.Status {
+		return false
+	}
+	if len(a.Builds) == 0 && len(b.Builds) == 0 {
+		return a.Message == b.Message
+	}
+	if len(a.Builds) != len(b.Builds) {
+		return false
+	}
+	for i := range a.Builds {
+		if a.Builds[i] != b.Builds[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func loadState(path string) (*state, error) {
+	st := &state{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		st.Alerts = make(map[string]alert)
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %s", path, err)
+	}
+	if st.Alerts == nil {
+		st.Alerts = make(map[string]alert)
+	}
+	return st, nil
+}
+
+func saveState(path string, st *state) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// writeFileAtomic writes to a temporary file first so that a concurrent reader never sees a partial one
+func writeFileAtomic(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// rememberAlerts records warnings and criticals of the results, forgetting jobs which resolved.
+// With `--alert-once`, an alert same as the recorded one is reported as OK,
+// while an escalation from warning to critical or another build alerts again.
+func (c *Client) rememberAlerts(path string, results []jobResult) error {
+	st, err := loadState(path)
+	if err != nil {
+		return err
+	}
+	for i, r := range results {
+		if r.checker.Status != checkers.WARNING && r.checker.Status != checkers.CRITICAL {
+			if r.checker.Status == checkers.OK {
+				delete(st.Alerts, r.job)
+			}
+			continue
+		}
+		a := alert{r.checker.Status.String(), r.checker.Message, r.builds}
+		if prev, ok := st.Alerts[r.job]; ok && prev.isSame(a) && c.opts.AlertOnce {
+			results[i].checker = checkers.Ok(fmt.Sprintf("%s (already alerted as %s)", a.Message, a.Status))
+		}
+		st.Alerts[r.job] = a
+	}
+	return saveState(path, st)
+}
+
+// rememberStatus records the status reported this time, returning the previous one
+func rememberStatus(path, status string) (string, error) {
+	st, err := loadState(path)
+	if err != nil {
+		return "", err
+	}
+	prev := st.Status
+	st.Status = status
+	return prev, saveState(path, st)
+}
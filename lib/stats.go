@@ -0,0 +1,50 @@
+package checkjenkinsbuildtime
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+func mean(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+	return sum / time.Duration(len(ds))
+}
+
+// stddev returns the population standard deviation
+func stddev(ds []time.Duration) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	m := float64(mean(ds))
+	var sum float64
+	for _, d := range ds {
+		sum += (float64(d) - m) * (float64(d) - m)
+	}
+	return time.Duration(math.Sqrt(sum / float64(len(ds))))
+}
+
+// percentile returns the p-th percentile (0-100) interpolating between the closest ranks
+func percentile(ds []time.Duration, p float64) time.Duration {
+	if len(ds) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, ds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	if lo < 0 {
+		return sorted[0]
+	}
+	if hi >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + time.Duration((rank-float64(lo))*float64(sorted[hi]-sorted[lo]))
+}
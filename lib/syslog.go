@@ -0,0 +1,34 @@
+//go:build !windows
+
+package checkjenkinsbuildtime
+
+import (
+	"log/syslog"
+
+	"github.com/mackerelio/checkers"
+)
+
+// syslogNetwork and syslogAddr are where writeSyslog writes, the local syslog when both are empty
+var syslogNetwork, syslogAddr string
+
+func syslogPriority(st checkers.Status) syslog.Priority {
+	switch st {
+	case checkers.OK:
+		return syslog.LOG_INFO
+	case checkers.WARNING:
+		return syslog.LOG_WARNING
+	case checkers.CRITICAL:
+		return syslog.LOG_CRIT
+	}
+	return syslog.LOG_ERR
+}
+
+func writeSyslog(ckr *checkers.Checker) error {
+	w, err := syslog.Dial(syslogNetwork, syslogAddr, syslogPriority(ckr.Status)|syslog.LOG_DAEMON, "check-jenkins-build-time")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	_, err = w.Write([]byte(ckr.String()))
+	return err
+}
@@ -0,0 +1,55 @@
+//go:build !windows
+
+package checkjenkinsbuildtime
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+// TestWriteSyslog captures the message and the priority with a stub syslog receiver
+func TestWriteSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	syslogNetwork, syslogAddr = "udp", conn.LocalAddr().String()
+	defer func() { syslogNetwork, syslogAddr = "", "" }()
+
+	tests := []struct {
+		ckr      *checkers.Checker
+		priority int
+	}{
+		// The priority is the facility of daemon (3) times 8 plus the severity
+		{checkers.Ok("No build that takes too long time exists"), 3*8 + 6},
+		{checkers.Warning("Build id = 3 takes too long time"), 3*8 + 4},
+		{checkers.Critical("Build id = 3 takes too long time"), 3*8 + 2},
+		{checkers.Unknown("Failed to fetch jenkins metrics"), 3*8 + 3},
+	}
+	for _, tt := range tests {
+		ckr := tt.ckr
+		ckr.Name = "JenkinsBuildTime-deploy"
+		if err := writeSyslog(ckr); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 2048)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := string(buf[:n])
+		if want := fmt.Sprintf("<%d>", tt.priority); !strings.HasPrefix(got, want) {
+			t.Errorf("%s: got %q, want the priority %s", ckr.Status, got, want)
+		}
+		if !strings.Contains(got, "check-jenkins-build-time") || !strings.Contains(got, ckr.String()) {
+			t.Errorf("%s: got %q, want the tag and %q", ckr.Status, got, ckr.String())
+		}
+	}
+}
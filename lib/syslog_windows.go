@@ -0,0 +1,11 @@
+package checkjenkinsbuildtime
+
+import (
+	"errors"
+
+	"github.com/mackerelio/checkers"
+)
+
+func writeSyslog(ckr *checkers.Checker) error {
+	return errors.New("syslog is not supported on windows")
+}
@@ -0,0 +1,60 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mackerelio/checkers"
+)
+
+/*
+The JUnit plugin reports the test results of the build.
+
+% curl -s "http://localhost:8080/job/build/lastCompletedBuild/testReport/api/json?tree=failCount,skipCount,passCount" | jq .
+{
+  "_class": "hudson.tasks.junit.TestResult",
+  "failCount": 3,
+  "passCount": 1250,
+  "skipCount": 12
+}
+*/
+
+type testReport struct {
+	FailCount int `json:"failCount"`
+	PassCount int `json:"passCount"`
+	SkipCount int `json:"skipCount"`
+}
+
+// countChecker returns the status of the count against the thresholds, where 0 disables a threshold
+func countChecker(n, warning, critical int, msg string) *checkers.Checker {
+	switch {
+	case critical > 0 && n >= critical:
+		return checkers.Critical(msg)
+	case warning > 0 && n >= warning:
+		return checkers.Warning(msg)
+	}
+	return nil
+}
+
+// hasTestThresholds reports whether any threshold of the test results is given
+func (o *Options) hasTestThresholds() bool {
+	return o.TestFailWarning > 0 || o.TestFailCritical > 0 || o.TestSkipWarning > 0 || o.TestSkipCritical > 0
+}
+
+// checkTests alerts on failing and skipped tests of the last completed build
+func (c *Client) checkTests(ctx context.Context, t target) *checkers.Checker {
+	var r testReport
+	if err := c.fetchJobJSON(ctx, t, "/lastCompletedBuild/testReport/api/json?tree=failCount,skipCount,passCount", &r); err != nil {
+		if e, ok := err.(*httpStatusError); ok && e.code == 404 {
+			// The build has not finished yet, or publishes no test results
+			return nil
+		}
+		return c.fetchErrorChecker(err)
+	}
+	url := c.jobURL(t.job, "/lastCompletedBuild/testReport/")
+	failed := countChecker(r.FailCount, c.opts.TestFailWarning, c.opts.TestFailCritical,
+		fmt.Sprintf("%d of %d tests failed in the last completed build %s", r.FailCount, r.FailCount+r.PassCount+r.SkipCount, url))
+	skipped := countChecker(r.SkipCount, c.opts.TestSkipWarning, c.opts.TestSkipCritical,
+		fmt.Sprintf("%d of %d tests were skipped in the last completed build %s", r.SkipCount, r.FailCount+r.PassCount+r.SkipCount, url))
+	return combine([]*checkers.Checker{failed, skipped})
+}
@@ -0,0 +1,173 @@
+package checkjenkinsbuildtime
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// NoThreshold disables the threshold, e.g. one of Thresholds or by `--no-warning` for jobs which should only page at critical
+const NoThreshold = time.Duration(math.MaxInt64)
+
+// formatThreshold prints the threshold, or that it is disabled
+func formatThreshold(d time.Duration) string {
+	if d == NoThreshold {
+		return "disabled"
+	}
+	return d.String()
+}
+
+// duration accepts a bare integer as seconds for compatibility, or a Go duration string such as `90m`
+type duration time.Duration
+
+func (d duration) Duration() time.Duration { return time.Duration(d) }
+
+// UnmarshalFlag implements flags.Unmarshaler
+func (d *duration) UnmarshalFlag(value string) error {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		*d = duration(time.Duration(n) * time.Second)
+		return nil
+	}
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: use seconds or a duration such as 90m", value)
+	}
+	*d = duration(v)
+	return nil
+}
+
+// UnmarshalTOML accepts thresholds of `--config` as seconds or duration strings the same way as the flags
+func (d *duration) UnmarshalTOML(v interface{}) error {
+	switch v := v.(type) {
+	case int64:
+		*d = duration(time.Duration(v) * time.Second)
+		return nil
+	case string:
+		return d.UnmarshalFlag(v)
+	}
+	return fmt.Errorf("invalid duration %v: use seconds or a duration such as \"90m\"", v)
+}
+
+// MarshalFlag implements flags.Marshaler
+func (d duration) MarshalFlag() (string, error) {
+	return d.Duration().String(), nil
+}
+
+// reconcileThreshold returns the threshold given both in seconds and as a duration,
+// which is the duration when it is given, and checks that the two agree when both are.
+func reconcileThreshold(isSet func(string) bool, secondFlag string, second duration, durationFlag string, dur time.Duration) (duration, error) {
+	if isSet(durationFlag) {
+		if isSet(secondFlag) && dur != second.Duration() {
+			return 0, fmt.Errorf("--%s=%s conflicts with --%s=%s", secondFlag, second.Duration(), durationFlag, dur)
+		}
+		second = duration(dur)
+	}
+	if second < 0 {
+		return 0, fmt.Errorf("threshold must not be negative: %s", second.Duration())
+	}
+	return second, nil
+}
+
+// resolveThresholds validates the thresholds and returns the effective ones, where isSet tells flags given explicitly.
+// o is left as it is unless every threshold is valid, and then the ones in seconds follow the durations given.
+func resolveThresholds(o *Options, isSet func(string) bool) (warning, critical time.Duration, err error) {
+	if o.NoWarning && (isSet("warning-second") || isSet("warning")) {
+		return 0, 0, fmt.Errorf("--no-warning conflicts with --warning-second and --warning")
+	}
+	if o.NoCritical && (isSet("critical-second") || isSet("critical")) {
+		return 0, 0, fmt.Errorf("--no-critical conflicts with --critical-second and --critical")
+	}
+	warningSecond, err := reconcileThreshold(isSet, "warning-second", o.WarningSecond, "warning", o.Warning)
+	if err != nil {
+		return 0, 0, err
+	}
+	critSecond, err := reconcileThreshold(isSet, "critical-second", o.CritSecond, "critical", o.Critical)
+	if err != nil {
+		return 0, 0, err
+	}
+	o.WarningSecond, o.CritSecond = warningSecond, critSecond
+	warning, critical = warningSecond.Duration(), critSecond.Duration()
+	if o.NoWarning {
+		warning = NoThreshold
+	}
+	if o.NoCritical {
+		critical = NoThreshold
+	}
+	return warning, critical, nil
+}
+
+// thresholds returns the effective thresholds of the options of the client, which may be given without flags,
+// e.g. by Run or NewClient. The durations are told given by being set.
+func (c *Client) thresholds() (warning, critical time.Duration, err error) {
+	opts := c.opts
+	return resolveThresholds(&opts, func(name string) bool {
+		return (name == "warning" && opts.Warning != 0) || (name == "critical" && opts.Critical != 0)
+	})
+}
+
+// overrideThresholds returns the thresholds with those given by the config or its schedule in place,
+// which are validated as the flags and stay disabled by `--no-warning` and `--no-critical`
+func (c *Client) overrideThresholds(warning, critical time.Duration, warningSecond, critSecond *duration) (time.Duration, time.Duration, error) {
+	opts := c.opts
+	opts.WarningSecond, opts.CritSecond = duration(warning), duration(critical)
+	if warningSecond != nil {
+		opts.WarningSecond = *warningSecond
+	}
+	if critSecond != nil {
+		opts.CritSecond = *critSecond
+	}
+	return resolveThresholds(&opts, func(string) bool { return false })
+}
+
+// thresholdFunc returns the threshold for the build, which may depend on the build itself
+type thresholdFunc func(build) time.Duration
+
+func fixedThreshold(d time.Duration) thresholdFunc {
+	return func(build) time.Duration { return d }
+}
+
+// percentOfEstimate returns the percentage of estimatedDuration as the threshold,
+// falling back to the fixed one for builds Jenkins cannot estimate yet
+func percentOfEstimate(fixed time.Duration, percent float64) thresholdFunc {
+	return func(b build) time.Duration {
+		if b.EstimatedDuration <= 0 {
+			return fixed
+		}
+		return time.Duration(float64(b.estimatedDuration()) * percent / 100)
+	}
+}
+
+// thresholdFuncs returns the warning and critical thresholds of the target.
+// Thresholds derived from the build history replace the fixed ones when there are enough builds.
+func (c *Client) thresholdFuncs(t target, builds []build) (warning, critical thresholdFunc) {
+	warning, critical = fixedThreshold(t.warning), fixedThreshold(t.critical)
+	if c.opts.AutoThreshold {
+		if ds := recentSuccessfulDurations(builds, c.opts.AutoBuilds); len(ds) >= 2 {
+			m, sd := mean(ds), stddev(ds)
+			warning = fixedThreshold(m + time.Duration(c.opts.AutoWarningK*float64(sd)))
+			critical = fixedThreshold(m + time.Duration(c.opts.AutoCriticalK*float64(sd)))
+		}
+	}
+	if c.opts.Percentile > 0 {
+		if ds := recentFinishedDurations(builds, len(builds)); len(ds) > 0 {
+			p := percentile(ds, c.opts.Percentile)
+			warning = fixedThreshold(time.Duration(c.opts.PercentileWarningMultiplier * float64(p)))
+			critical = fixedThreshold(time.Duration(c.opts.PercentileCriticalMultiplier * float64(p)))
+		}
+	}
+	if c.opts.WarningPercent > 0 {
+		warning = percentOfEstimate(t.warning, c.opts.WarningPercent)
+	}
+	if c.opts.CriticalPercent > 0 {
+		critical = percentOfEstimate(t.critical, c.opts.CriticalPercent)
+	}
+	// Thresholds derived from the builds do not bring back a disabled one
+	if t.warning == NoThreshold {
+		warning = fixedThreshold(NoThreshold)
+	}
+	if t.critical == NoThreshold {
+		critical = fixedThreshold(NoThreshold)
+	}
+	return warning, critical
+}
@@ -0,0 +1,80 @@
+package checkjenkinsbuildtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+)
+
+func TestResolveThresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		warning  time.Duration
+		critical time.Duration
+		wantErr  bool
+	}{
+		{"defaults", nil, time.Minute, 5 * time.Minute, false},
+		{"seconds", []string{"-w", "90", "-c", "600"}, 90 * time.Second, 10 * time.Minute, false},
+		{"duration strings in seconds", []string{"-w", "90m", "-c", "4h"}, 90 * time.Minute, 4 * time.Hour, false},
+		{"durations", []string{"--warning", "2m", "--critical", "1h"}, 2 * time.Minute, time.Hour, false},
+		{"seconds agreeing with the duration", []string{"-w", "120", "--warning", "2m"}, 2 * time.Minute, 5 * time.Minute, false},
+		{"seconds conflicting with the duration", []string{"-w", "60", "--warning", "2m"}, 0, 0, true},
+		{"no warning", []string{"--no-warning"}, NoThreshold, 5 * time.Minute, false},
+		{"no critical", []string{"--no-critical"}, time.Minute, NoThreshold, false},
+		{"no warning with the seconds", []string{"--no-warning", "-w", "10"}, 0, 0, true},
+		{"no critical with the duration", []string{"--no-critical", "--critical", "1h"}, 0, 0, true},
+		{"negative seconds", []string{"-w", "-5"}, 0, 0, true},
+		{"negative duration", []string{"--warning", "2m", "--critical", "-1m"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := NewOptions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = parseFlags(&opts, append([]string{"-j", "deploy"}, tt.args...), flags.None)
+			if tt.wantErr {
+				if _, ok := err.(*thresholdError); !ok {
+					t.Fatalf("error = %v, want thresholdError", err)
+				}
+				// Nothing is changed by the thresholds which failed
+				if opts.WarningSecond.Duration() == 2*time.Minute {
+					t.Errorf("--warning-second followed the invalid thresholds")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			warning, critical, err := NewClient(opts).thresholds()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if warning != tt.warning || critical != tt.critical {
+				t.Errorf("thresholds = (%s, %s), want (%s, %s)", formatThreshold(warning), formatThreshold(critical), formatThreshold(tt.warning), formatThreshold(tt.critical))
+			}
+		})
+	}
+}
+
+// TestThresholdsWithoutFlags resolves the options of library callers, given without flags
+func TestThresholdsWithoutFlags(t *testing.T) {
+	opts, err := NewOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Warning = 10 * time.Minute
+	warning, critical, err := NewClient(opts).thresholds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warning != 10*time.Minute || critical != 5*time.Minute {
+		t.Errorf("thresholds = (%s, %s), want (10m0s, 5m0s)", warning, critical)
+	}
+	opts.Critical = -time.Minute
+	if _, _, err := NewClient(opts).thresholds(); err == nil {
+		t.Error("negative --critical was accepted")
+	}
+}
@@ -0,0 +1,63 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+/*
+The secret of `--vault-path` is read from VAULT_ADDR with VAULT_TOKEN, as the vault command does.
+Both of the KV secrets engines are supported, whose responses nest the secret differently.
+
+% curl -s -H "X-Vault-Token: $VAULT_TOKEN" "$VAULT_ADDR/v1/secret/data/jenkins" | jq .data
+{
+  "data": {
+    "user": "monitor",
+    "api_token": "11d3a7b1f2..."
+  },
+  "metadata": {
+    "version": 3
+  }
+}
+*/
+
+func fetchVaultSecret(ctx context.Context, hc *http.Client, path string) (map[string]interface{}, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, errors.New("VAULT_ADDR and VAULT_TOKEN are required for --vault-path")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault answered %s", resp.Status)
+	}
+	var v struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	// KV version 2 nests the secret in data with its metadata
+	if inner, ok := v.Data["data"].(map[string]interface{}); ok {
+		if _, ok := v.Data["metadata"]; ok {
+			return inner, nil
+		}
+	}
+	return v.Data, nil
+}
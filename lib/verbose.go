@@ -0,0 +1,66 @@
+package checkjenkinsbuildtime
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// secretHeaders are redacted from `--verbose` logs
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+func isSecretHeader(name string) bool {
+	lower := strings.ToLower(name)
+	return secretHeaders[http.CanonicalHeaderKey(name)] || strings.Contains(lower, "token") || strings.Contains(lower, "secret")
+}
+
+// logRequest writes the request and how it was answered to stderr with `--verbose`
+func logRequest(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+	// The user and the API token may be given in the userinfo of `--url`
+	log.Printf("> %s %s", req.Method, req.URL.Redacted())
+	if req.Host != "" && req.Host != req.URL.Host {
+		log.Printf("> Host: %s", req.Host)
+	}
+	logHeaders(">", req.Header)
+	if err != nil {
+		log.Printf("< %s (%s)", err, elapsed.Round(time.Millisecond))
+		return
+	}
+	log.Printf("< %s (%s)", resp.Status, elapsed.Round(time.Millisecond))
+	logHeaders("<", resp.Header)
+}
+
+// logHeaders writes the headers in the order of their names, redacting the secret ones
+func logHeaders(prefix string, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			if isSecretHeader(name) {
+				v = redact(name, v)
+			}
+			log.Printf("%s %s: %s", prefix, name, v)
+		}
+	}
+}
+
+// redact keeps only the scheme of credentials such as `Basic` or `Bearer`, and nothing of the other secrets, e.g. cookies
+func redact(name, v string) string {
+	if !strings.HasSuffix(http.CanonicalHeaderKey(name), "Authorization") {
+		return "[REDACTED]"
+	}
+	if i := strings.Index(v, " "); i > 0 {
+		return v[:i] + " [REDACTED]"
+	}
+	return "[REDACTED]"
+}
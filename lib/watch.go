@@ -0,0 +1,24 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// watch prints the result of the check on every interval until ctx is done, e.g. by Ctrl-C or systemd
+func (c *Client) watch(ctx context.Context, interval time.Duration) {
+	for ctx.Err() == nil {
+		ckr, _ := c.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		ckr.Name = c.opts.checkName()
+		c.notifyChange(ckr)
+		fmt.Printf("%s %s\n", time.Now().Format(time.RFC3339), ckr.String())
+		select {
+		case <-ctx.Done():
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package checkjenkinsbuildtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+type webhookPayload struct {
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previous_status"`
+	Message        string `json:"message"`
+	Time           string `json:"time"`
+}
+
+// notifyChange posts the result to `--notify-webhook` when the status changed from the last one.
+// Nothing is posted on the first run since there is nothing to compare with.
+func (c *Client) notifyChange(ckr *checkers.Checker) {
+	if c.opts.NotifyWebhook == "" {
+		return
+	}
+	cur := ckr.Status.String()
+	prev := c.lastStatus
+	if c.opts.StateFile != "" {
+		var err error
+		if prev, err = rememberStatus(c.opts.StateFile, cur); err != nil {
+			log.Printf("Failed to update the state file: %s", err)
+			return
+		}
+	}
+	c.lastStatus = cur
+	if prev == "" || prev == cur {
+		return
+	}
+	if err := c.postWebhook(webhookPayload{ckr.Name, cur, prev, ckr.Message, time.Now().Format(time.RFC3339)}); err != nil {
+		log.Printf("Failed to notify the webhook: %s", err)
+	}
+}
+
+func (c *Client) postWebhook(p webhookPayload) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	// Sent by the client bounded by --timeout so that an unreachable webhook does not hold the result
+	resp, err := c.outboundClient().Post(c.opts.NotifyWebhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package checkjenkinsbuildtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+/*
+Pipeline jobs expose stage information via the wfapi (Pipeline Stage View plugin).
+
+% curl -s "http://localhost:8080/job/pipeline/12/wfapi/describe" | jq .
+{
+  "id": "12",
+  "status": "IN_PROGRESS",
+  "stages": [
+    {
+      "name": "Build",
+      "status": "SUCCESS",
+      "startTimeMillis": 1503146442652,
+      "durationMillis": 30120
+    }
+  ]
+}
+*/
+
+type wfStage struct {
+	Name            string `json:"name"`
+	Status          string `json:"status"`
+	StartTimeMillis int64  `json:"startTimeMillis"`
+	DurationMillis  int64  `json:"durationMillis"`
+}
+
+type wfRun struct {
+	Status string    `json:"status"`
+	Stages []wfStage `json:"stages"`
+}
+
+func (s wfStage) isCompleted() bool {
+	switch s.Status {
+	// NOT_EXECUTED stages, e.g. skipped by `when`, never run
+	case "SUCCESS", "FAILED", "UNSTABLE", "ABORTED", "NOT_EXECUTED":
+		return true
+	}
+	return false
+}
+
+// isPostBuildStuck reports whether every stage has completed while the run itself is still in progress
+func (r wfRun) isPostBuildStuck() bool {
+	if r.Status != "IN_PROGRESS" || len(r.Stages) == 0 {
+		return false
+	}
+	for _, s := range r.Stages {
+		if !s.isCompleted() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) fetchWfRun(ctx context.Context, t target, number int) (wfRun, error) {
+	var r wfRun
+	err := c.fetchJobJSON(ctx, t, fmt.Sprintf("/%d/wfapi/describe", number), &r)
+	return r, err
+}
+
+// isPostBuildStuck returns false when the stage information is unavailable (e.g. freestyle jobs)
+func (c *Client) isPostBuildStuck(ctx context.Context, t target, b build) bool {
+	r, err := c.fetchWfRun(ctx, t, b.Number)
+	if err != nil {
+		return false
+	}
+	return r.isPostBuildStuck()
+}
+
+// runningStage returns the stage of the name if it is in progress
+func (r wfRun) runningStage(name string) (wfStage, bool) {
+	for _, s := range r.Stages {
+		if s.Name == name && s.Status == "IN_PROGRESS" {
+			return s, true
+		}
+	}
+	return wfStage{}, false
+}
+
+// checkStage alerts on the stage given by `--stage` running too long in any unfinished build,
+// even if the whole build is still within the thresholds
+func (c *Client) checkStage(ctx context.Context, t target, bs []build) *checkers.Checker {
+	var ckr *checkers.Checker
+	for _, b := range bs {
+		if !b.isUnfinished() {
+			continue
+		}
+		r, err := c.fetchWfRun(ctx, t, b.Number)
+		if err != nil {
+			continue
+		}
+		s, ok := r.runningStage(c.opts.Stage)
+		if !ok {
+			continue
+		}
+		elapsed := c.now().Sub(time.Unix(0, s.StartTimeMillis*int64(time.Millisecond)))
+		msg := fmt.Sprintf("Stage %s of build id = %d has been running for %s", s.Name, b.Number, elapsed.Round(time.Second))
+		switch {
+		case c.opts.StageCritical > 0 && elapsed > c.opts.StageCritical.Duration():
+			return checkers.Critical(msg)
+		case c.opts.StageWarning > 0 && elapsed > c.opts.StageWarning.Duration():
+			ckr = checkers.Warning(msg)
+		}
+	}
+	return ckr
+}
@@ -0,0 +1,63 @@
+package checkjenkinsbuildtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mackerelio/checkers"
+)
+
+func TestWfRunIsPostBuildStuck(t *testing.T) {
+	tests := []struct {
+		name string
+		run  wfRun
+		want bool
+	}{
+		{"every stage completed", wfRun{"IN_PROGRESS", []wfStage{{Status: "SUCCESS"}, {Status: "FAILED"}}}, true},
+		{"skipped stage", wfRun{"IN_PROGRESS", []wfStage{{Status: "SUCCESS"}, {Status: "NOT_EXECUTED"}}}, true},
+		{"stage in progress", wfRun{"IN_PROGRESS", []wfStage{{Status: "SUCCESS"}, {Status: "IN_PROGRESS"}}}, false},
+		{"run completed", wfRun{"SUCCESS", []wfStage{{Status: "SUCCESS"}}}, false},
+		{"no stage", wfRun{"IN_PROGRESS", nil}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.run.isPostBuildStuck(); got != tt.want {
+				t.Errorf("isPostBuildStuck() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDetectPostBuild fetches the stages of a build over both thresholds only once
+func TestDetectPostBuild(t *testing.T) {
+	var describes int64
+	jobs := buildsJSON(stubBuild{number: 5, ago: 10 * time.Minute})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/job/pipeline/5/wfapi/describe":
+			atomic.AddInt64(&describes, 1)
+			w.Write([]byte(`{"id": "5", "status": "IN_PROGRESS", "stages": [{"name": "Build", "status": "SUCCESS"}, {"name": "Deploy", "status": "NOT_EXECUTED"}]}`))
+		case "/job/pipeline/api/json":
+			w.Write([]byte(jobs))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ckr := testRun(t, srv.URL, "-j", "pipeline", "-w", "60", "-c", "300", "--detect-postbuild")
+	if ckr.Status != checkers.CRITICAL {
+		t.Errorf("status = %s, want CRITICAL: %s", ckr.Status, ckr.Message)
+	}
+	if !strings.Contains(ckr.Message, "(stuck in post-build)") {
+		t.Errorf("message = %q, want the build labeled as stuck in post-build", ckr.Message)
+	}
+	if describes != 1 {
+		t.Errorf("wfapi was fetched %d times, want 1", describes)
+	}
+}